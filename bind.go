@@ -2,7 +2,6 @@ package jvmao
 
 import (
 	"encoding"
-	"encoding/json"
 	"errors"
 	"reflect"
 	"strconv"
@@ -23,7 +22,7 @@ func (c *context) BindForm(dest interface{}) error {
 	case strings.HasPrefix(ct, MIMEApplicationForm), strings.HasPrefix(ct, MIMEMultipartForm):
 		return bind("form", dest, c)
 	case strings.HasPrefix(ct, MIMEApplicationJSON):
-		return json.NewDecoder(c.r.Body).Decode(dest)
+		return c.jm.Serializer().Deserialize(c.r.Body, dest)
 	default:
 		return errors.New("BindForm unsupports header content type " + ct)
 	}
@@ -67,6 +66,10 @@ func bind(tag string, dest interface{}, c Context) error {
 			continue
 		}
 
+		if tag == "param" && bindTypedParam(vf, fName, c) {
+			continue
+		}
+
 		if vf.Kind() == reflect.Slice {
 			d := getSliceData(tag, fName, c)
 			if len(d) > 0 {
@@ -81,6 +84,33 @@ func bind(tag string, dest interface{}, c Context) error {
 	return nil
 }
 
+// bindTypedParam sets v with the value converted by the constraint of
+// the param, it reports false when the value doesn't fit v.
+func bindTypedParam(v reflect.Value, key string, c Context) bool {
+	ctx, ok := c.(*context)
+	if !ok {
+		return false
+	}
+	p := ctx.param(key)
+	if p == nil || p.typed == nil {
+		return false
+	}
+	tv := reflect.ValueOf(p.typed)
+	if v.Kind() == reflect.Ptr && tv.Type().AssignableTo(v.Type().Elem()) {
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	}
+	switch {
+	case tv.Type().AssignableTo(v.Type()):
+		v.Set(tv)
+	case tv.CanInt() && v.CanInt() && !v.OverflowInt(tv.Int()):
+		v.SetInt(tv.Int())
+	default:
+		return false
+	}
+	return true
+}
+
 func bindSliceField(v reflect.Value, data []string) error {
 
 	l := len(data)
@@ -63,3 +63,22 @@ func TestBindForm(t *testing.T) {
 	fmt.Println(p)
 
 }
+
+func TestBindParam(t *testing.T) {
+	type params struct {
+		ID   int    `param:"id"`
+		Slug string `param:"slug"`
+	}
+
+	jm := New()
+	var p params
+	jm.GET("/posts/{id:int}/{slug:slug}", "post", func(c Context) error {
+		return c.BindParam(&p)
+	})
+
+	rec := httptest.NewRecorder()
+	jm.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/posts/42/hello-world", nil))
+	if p.ID != 42 || p.Slug != "hello-world" {
+		t.Fatal("BindParam:", p)
+	}
+}
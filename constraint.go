@@ -0,0 +1,50 @@
+package jvmao
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Constraint checks a route param and returns its converted value,
+// the route doesn't match the request when ok is false.
+//
+// ie. a constraint registered as "int" is used as "/users/{id:int}".
+type Constraint func(param string) (v interface{}, ok bool)
+
+var (
+	uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	slugRe = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+)
+
+func defaultConstraints() map[string]Constraint {
+	return map[string]Constraint{
+		"int": func(s string) (interface{}, bool) {
+			i, err := strconv.Atoi(s)
+			return i, err == nil
+		},
+		"uuid": RegexpConstraint(uuidRe),
+		"slug": RegexpConstraint(slugRe),
+	}
+}
+
+// RegexpConstraint returns a Constraint accepting params which match re.
+// the param is kept as string.
+func RegexpConstraint(re *regexp.Regexp) Constraint {
+	return func(s string) (interface{}, bool) {
+		return s, re.MatchString(s)
+	}
+}
+
+// constraint returns the registered constraint with name,
+// others are compiled as regular expression matching the whole param.
+func (m *mux) constraint(name string) (Constraint, error) {
+	if c, ok := m.constraints[name]; ok {
+		return c, nil
+	}
+	re, err := regexp.Compile(`^(?:` + name + `)$`)
+	if err != nil {
+		return nil, fmt.Errorf("jvmao: bad constraint %q: %w", name, err)
+	}
+	return RegexpConstraint(re), nil
+}
@@ -2,30 +2,68 @@ package jvmao
 
 import (
 	"bytes"
-	"encoding/json"
+	ctx "context"
 	"errors"
 	"io"
 	"io/fs"
+	"iter"
 	"mime/multipart"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 )
 
 const maxMemory = 32 << 20 // 32 MB
 
 type Context interface {
+	// Context delegates to the context of the request, Value finds
+	// the values of Set by their string key first. the Context is
+	// reused by the next requests, it must not be kept as a
+	// context.Context after the handler returns.
+	ctx.Context
+
 	Request() *http.Request
 
+	// SetRequest replaces the request for the next handlers.
+	SetRequest(r *http.Request)
+
+	// WithContext replaces the context of the request for the next
+	// handlers, such as with a derived deadline or values. ctx must be
+	// derived from Request().Context(), it panics when it is derived
+	// from the Context itself, which would delegate to ctx again.
+	WithContext(ctx ctx.Context)
+
 	Response() *Response
 
+	// SetResponse replaces the response for the next handlers.
+	SetResponse(w *Response)
+
 	//Reverse the path with name.
-	Reverse(name string, params ...string) string
+	// params fill in the pattern's parameters in order.
+	Reverse(name string, params ...string) (string, error)
+
+	// Route returns the route matched by the request, with its pattern,
+	// name and metadata. it is nil before routing and when no route
+	// matches.
+	Route() *Route
+
+	// SSE sends the header of server-sent events and returns the writer
+	// of the events. it stops when the client disconnects.
+	SSE() *EventStream
+
+	// WebSocket upgrades the request to a WebSocket with the default
+	// WebSocketOptions, use Upgrade for others. over HTTP/2 the GET
+	// route serves the extended CONNECT of the client, which the server
+	// accepts with GODEBUG=http2xconnect=1 only.
+	WebSocket() (*WebSocket, error)
 
 	HanderValue(key string) string
 
 	Set(key string, value interface{})
 
+	// Get returns the value of Set, or of the request context when
+	// it was not set.
 	Get(key string) interface{}
 
 	Del(key string)
@@ -50,7 +88,8 @@ type Context interface {
 	QueryValues(key string) []string
 
 	// Param is the parameters in route pattern.
-	// such as "id" in /post/:id .
+	// such as "id" in /post/:id , /post/{id} , "path" in /files/*path
+	// and /files/{path...} .
 
 	// ParamValue get the parameter.
 	ParamValue(key string) string
@@ -72,9 +111,13 @@ type Context interface {
 	BindParam(i interface{}) error
 
 	//Render render a template then send a HTML response with status code
-	// it'll use the DefalultRenderer when the jumao's Renderer was not set
+	// it'll use the DefalultRenderer when the jumao's Renderer was not set.
+	// nothing is sent when rendering fails, the error is returned.
 	Render(statusCode int, tmpl string, data interface{}) (err error)
 
+	// Debug reports whether the debug mode of the Jvmao is open.
+	Debug() bool
+
 	Error(statusCode int, err error) error
 
 	NoContent(statusCode int) error
@@ -91,6 +134,25 @@ type Context interface {
 	//Json send a json response with status code.
 	Json(statusCode int, i interface{}) error
 
+	// Negotiate sends data with status code, encoded by the encoder of
+	// the Jvmao the Accept header prefers. it calls the not acceptable
+	// handler when none is accepted.
+	Negotiate(statusCode int, data any) error
+
+	// Stream sends the content of r with status code and content type,
+	// without holding it in memory. it is flushed as the StreamOptions
+	// of the Jvmao set, and stops when the request context is done.
+	Stream(statusCode int, contentType string, r io.Reader) error
+
+	// JSONStream sends the values of seq as JSON lines (NDJSON), flushed
+	// as Stream.
+	JSONStream(statusCode int, seq iter.Seq[any]) error
+
+	// Pipe sends what fn writes to w with status code and content type,
+	// flushed as Stream. the writes to w fail once the request context
+	// is done.
+	Pipe(statusCode int, contentType string, fn func(w io.Writer) error) error
+
 	//File send a file response with status code
 	File(file string, dir http.Dir) error
 
@@ -100,31 +162,115 @@ type Context interface {
 	//Redirect to provided URL
 	Redirect(statusCode int, url string) error
 
-	// Logger() Logger
+	// Logger returns the logger of the request, it carries the request id,
+	// method, path, route name and remote IP. the route name is empty
+	// before routing.
+	Logger() *Logger
+
+	// SetLogger replaces the logger of the request, such as with more
+	// fields, the next handlers and the error handler get it.
+	SetLogger(l *Logger)
 }
 
 type context struct {
 	r *http.Request
 	w *Response
 
-	params url.Values
+	params []param
+	// values is the buffer of the param values the Router finds.
+	values []string
 	data   map[string]interface{}
 	err    *HTTPError
+	route  *Route
+	logger *Logger
+	// logRoute is the route logger was built for, logSet reports
+	// SetLogger replaced it.
+	logRoute *Route
+	logSet   bool
+	// finish runs when the handler returns, before the context is reused.
+	finish []func()
 
-	route *routeChache
+	mux *mux
+	jm  *Jvmao
 }
 
 func (c *context) Request() *http.Request {
 	return c.r
 }
 
+func (c *context) SetRequest(r *http.Request) {
+	c.checkContext(r.Context())
+	c.r = r
+}
+
+func (c *context) WithContext(ctx ctx.Context) {
+	c.checkContext(ctx)
+	c.r = c.r.WithContext(ctx)
+}
+
+// selfKey is the key of the Value of a context returning itself.
+type selfKey struct{}
+
+// checkContext panics when cx is derived from c, c delegating to the
+// context of the request would loop forever.
+func (c *context) checkContext(cx ctx.Context) {
+	if cx.Value(selfKey{}) == c {
+		panic(errors.New("jvmao: the context of the request is derived from the Context, derive it from Request().Context()"))
+	}
+}
+
+func (c *context) Deadline() (time.Time, bool) {
+	return c.r.Context().Deadline()
+}
+
+func (c *context) Done() <-chan struct{} {
+	return c.r.Context().Done()
+}
+
+func (c *context) Err() error {
+	return c.r.Context().Err()
+}
+
+func (c *context) Value(key any) any {
+	if key == (selfKey{}) {
+		return c
+	}
+	if k, ok := key.(string); ok {
+		if v, ok := c.data[k]; ok {
+			return v
+		}
+	}
+	return c.r.Context().Value(key)
+}
+
 func (c *context) Response() *Response {
 	return c.w
 }
 
-func (c *context) Reverse(name string, params ...string) string {
-	// return c.jm.Reverse(name, params...)
-	return ""
+func (c *context) SetResponse(w *Response) {
+	c.w = w
+}
+
+func (c *context) SSE() *EventStream {
+	return newEventStream(c)
+}
+
+func (c *context) WebSocket() (*WebSocket, error) {
+	return Upgrade(c, WebSocketOptions{})
+}
+
+// onFinish adds f to run when the handler returns, such as stopping
+// the goroutines writing to the response.
+func (c *context) onFinish(f func()) {
+	c.finish = append(c.finish, f)
+}
+
+func (c *context) Route() *Route {
+	return c.route
+}
+
+func (c *context) Reverse(name string, params ...string) (string, error) {
+	return c.mux.routes().Reverse(name, params...)
 }
 
 func (c *context) HanderValue(key string) string {
@@ -132,6 +278,9 @@ func (c *context) HanderValue(key string) string {
 }
 
 func (c *context) Set(key string, value interface{}) {
+	if c.data == nil {
+		c.data = map[string]interface{}{}
+	}
 	c.data[key] = value
 }
 
@@ -140,7 +289,7 @@ func (c *context) Get(key string) interface{} {
 	if v, ok := c.data[key]; ok {
 		return v
 	}
-	return nil
+	return c.r.Context().Value(key)
 }
 
 func (c *context) Del(key string) {
@@ -172,15 +321,31 @@ func (c *context) QueryValues(key string) []string {
 }
 
 func (c *context) Param() url.Values {
-	return c.params
+	v := url.Values{}
+	for _, p := range c.params {
+		v.Add(p.key, p.value)
+	}
+	return v
 }
 
 func (c *context) ParamValue(key string) string {
-	return c.r.PathValue(key)
+	if p := c.param(key); p != nil {
+		return p.value
+	}
+	return ""
 }
 
 func (c *context) ParamValues(key string) []string {
-	return c.params[key]
+	return c.Param()[key]
+}
+
+func (c *context) param(key string) *param {
+	for i := range c.params {
+		if c.params[i].key == key {
+			return &c.params[i]
+		}
+	}
+	return nil
 }
 
 func (c *context) FormValue(name string) string {
@@ -219,14 +384,18 @@ func (c *context) Render(statusCode int, tmpl string, data interface{}) (err err
 
 	buf := new(bytes.Buffer)
 
-	// if err = c.jm.renderer.Render(buf, tmpl, data, c); err != nil {
-	// 	panic(err)
-	// }
+	if err = c.jm.Renderer().Render(buf, tmpl, data, c); err != nil {
+		return err
+	}
 
 	return c.Blob(statusCode, MIMETextHTMLUTF8, buf.Bytes())
 
 }
 
+func (c *context) Debug() bool {
+	return c.jm.Debug()
+}
+
 func (c *context) Error(statusCode int, err error) error {
 	if _, ok := err.(*HTTPError); ok {
 		return err
@@ -259,13 +428,20 @@ func (c *context) Blob(statusCode int, contentType string, b []byte) (err error)
 }
 
 // Json send a json response with status code.
+// it is encoded to the response by the Serializer of the Jvmao, the
+// header is sent by the first write.
 func (c *context) Json(statusCode int, i interface{}) error {
-
-	b, err := json.Marshal(i)
-	if err != nil {
+	c.setHct(MIMEApplicationJSONUTF8)
+	c.w.Status = statusCode
+	if err := c.jm.Serializer().Serialize(c.w, i, c.jm.jsonIndent()); err != nil {
+		if c.w.wroteHeader {
+			return err
+		}
+		c.w.Header().Del(HeaderContentType)
 		return c.Error(500, err)
 	}
-	return c.Blob(statusCode, MIMEApplicationJSONUTF8, b)
+	c.WriteHeader(statusCode)
+	return nil
 }
 
 func (c *context) FileFS(file string, fsys fs.FS) error {
@@ -305,9 +481,29 @@ func (c *context) openFile(file string, dir http.FileSystem) error {
 	return nil
 }
 
-/* func (c *context) Logger() Logger { */
-/* return c.jm.Logger */
-/* } */
+func (c *context) Logger() *Logger {
+	// the logger built before routing is rebuilt with the route.
+	if c.logger == nil || (!c.logSet && c.logRoute != c.route) {
+		name := ""
+		if c.route != nil {
+			name = c.route.Name
+		}
+		c.logger = c.jm.Logger.With(
+			"request_id", requestID(c.r, c.w),
+			"method", c.r.Method,
+			"path", c.r.URL.Path,
+			"route", name,
+			"remote_ip", realIP(c.r),
+		)
+		c.logRoute = c.route
+	}
+	return c.logger
+}
+
+func (c *context) SetLogger(l *Logger) {
+	c.logger = l
+	c.logSet = l != nil
+}
 
 func (c *context) Redirect(statusCode int, url string) error {
 	if statusCode < 300 || statusCode > 308 {
@@ -327,8 +523,22 @@ func (c *context) reset(w http.ResponseWriter, r *http.Request) {
 	c.w.reset(w)
 	c.err = nil
 	c.r = r
-	c.params = url.Values{}
-	c.data = map[string]interface{}{}
+	c.route = nil
+	c.logger = nil
+	c.logRoute = nil
+	c.logSet = false
+	c.finish = c.finish[:0]
+	c.params = c.params[:0]
+	c.values = c.values[:0]
+	clear(c.data)
+}
+
+// param is a route param, typed is the value converted by the
+// constraint of the param.
+type param struct {
+	key   string
+	value string
+	typed interface{}
 }
 
 func newCtxFS(dir http.Dir) fs.FS {
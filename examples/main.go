@@ -93,7 +93,7 @@ func main() {
 	j.GET("/grpc", "grpc", h3)
 
 	g := j.Group("/group")
-	g.GET("g-home", "/", h)
+	g.GET("/", "g-home", h)
 
 	j.Static("static/", "/static/")
 	j.FileFS("client/client.go", fs)
@@ -1,61 +1,172 @@
 package jvmao
 
 import (
+	"fmt"
 	"net/http"
-	"strings"
+	"path"
 )
 
 type Group struct {
 	jm         *Jvmao
+	parent     *Group
+	host       string
 	prefix     string
 	middleware []MiddlewareFunc
+	errHandler HTTPErrorHandler
+	version    string
 }
 
+// Use adds middleware to the routes of the group and its sub groups,
+// they run after the middleware of the parents.
 func (g *Group) Use(middleware ...MiddlewareFunc) {
+	g.jm.mwMu.Lock()
+	defer g.jm.mwMu.Unlock()
 	g.middleware = append(g.middleware, middleware...)
+	g.jm.mwGen.Add(1)
+}
+
+// stack returns the middleware of the parents then g's,
+// the caller holds jm.mwMu.
+func (g *Group) stack() []MiddlewareFunc {
+	if g == nil {
+		return nil
+	}
+	return append(g.parent.stack(), g.middleware...)
+}
+
+// SetNotFoundHandler sets the handler for requests under the prefix of
+// the group which match no route, the sub groups inherit it.
+// it panics on the groups of a version, which would serve the requests
+// of all the versions.
+func (g *Group) SetNotFoundHandler(h HandlerFunc) {
+	if g.version != "" {
+		panic(fmt.Errorf("jvmao: not found handler of the version %q group %q", g.version, g.prefix))
+	}
+	if err := g.jm.mux.SetGroupNotFoundHandler(g.host, g.prefix, g.handleError(h)); err != nil {
+		panic(err)
+	}
+}
+
+// SetHTTPErrorHandler sets the handler of the errors returned by the
+// routes of the group and its sub groups, and of the method not allowed
+// or not acceptable on their paths. the errors the group doesn't handle
+// go to the handler of the parents then the Jvmao's.
+func (g *Group) SetHTTPErrorHandler(h HTTPErrorHandler) {
+	g.jm.mwMu.Lock()
+	defer g.jm.mwMu.Unlock()
+	g.errHandler = h
+}
+
+// httpErrorHandler returns the error handler of g or its nearest parent.
+func (g *Group) httpErrorHandler() HTTPErrorHandler {
+	g.jm.mwMu.RLock()
+	defer g.jm.mwMu.RUnlock()
+	for ; g != nil; g = g.parent {
+		if g.errHandler != nil {
+			return g.errHandler
+		}
+	}
+	return nil
+}
+
+// handleError sends the error returned by h to the error handler of g.
+func (g *Group) handleError(h HandlerFunc) HandlerFunc {
+	return func(c Context) error {
+		err := h(c)
+		if err == nil {
+			return nil
+		}
+		if eh := g.httpErrorHandler(); eh != nil {
+			eh(err, c)
+			return nil
+		}
+		return err
+	}
 }
 
 func (g *Group) Group(prefix string) *Group {
-	gp := &Group{prefix: g.prefix + "/" + prefix, jm: g.jm}
-	gp.middleware = append(gp.middleware, g.middleware...)
-	return gp
+	return &Group{parent: g, host: g.host, prefix: groupPrefix(g.prefix + "/" + prefix), version: g.version, jm: g.jm}
+}
+
+// Version returns a sub group whose routes serve the requests asking
+// version.
+func (g *Group) Version(version string) *Group {
+	return &Group{parent: g, host: g.host, prefix: g.prefix, version: version, jm: g.jm}
+}
+
+// Mount serves h for all the methods under prefix in the group,
+// the prefix of the group and prefix are stripped from the request path
+// h gets.
+func (g *Group) Mount(prefix string, h http.Handler, middleware ...MiddlewareFunc) {
+	prefix = groupPrefix(prefix)
+	mh := mountHandler(h)
+	if prefix != "" {
+		g.Any(prefix, "", mh, middleware...)
+	}
+	g.Any(prefix+"/", "", mh, middleware...)
 }
 
-func (g *Group) CONNECT(pattern, name string, handler HandlerFunc) {
-	g.handle(name, http.MethodConnect, pattern, handler)
+func (g *Group) CONNECT(pattern, name string, handler HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	return g.handle(name, http.MethodConnect, pattern, nil, handler, middleware...)
 }
-func (g *Group) HEAD(pattern, name string, handler HandlerFunc) {
-	g.handle(name, http.MethodHead, pattern, handler)
+func (g *Group) HEAD(pattern, name string, handler HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	return g.handle(name, http.MethodHead, pattern, nil, handler, middleware...)
 }
-func (g *Group) OPTIONS(pattern, name string, handler HandlerFunc) {
-	g.handle(name, http.MethodOptions, pattern, handler)
+func (g *Group) OPTIONS(pattern, name string, handler HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	return g.handle(name, http.MethodOptions, pattern, nil, handler, middleware...)
 }
-func (g *Group) PATCH(pattern, name string, handler HandlerFunc) {
-	g.handle(name, http.MethodPatch, pattern, handler)
+func (g *Group) PATCH(pattern, name string, handler HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	return g.handle(name, http.MethodPatch, pattern, nil, handler, middleware...)
 }
-func (g *Group) GET(pattern, name string, handler HandlerFunc) {
-	g.handle(name, http.MethodGet, pattern, handler)
+func (g *Group) GET(pattern, name string, handler HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	return g.handle(name, http.MethodGet, pattern, nil, handler, middleware...)
 }
-func (g *Group) POST(pattern, name string, handler HandlerFunc) {
-	g.handle(name, http.MethodPost, pattern, handler)
+func (g *Group) POST(pattern, name string, handler HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	return g.handle(name, http.MethodPost, pattern, nil, handler, middleware...)
 }
-func (g *Group) PUT(pattern, name string, handler HandlerFunc) {
-	g.handle(name, http.MethodPut, pattern, handler)
+func (g *Group) PUT(pattern, name string, handler HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	return g.handle(name, http.MethodPut, pattern, nil, handler, middleware...)
 }
-func (g *Group) DELETE(pattern, name string, handler HandlerFunc) {
-	g.handle(name, http.MethodDelete, pattern, handler)
+func (g *Group) DELETE(pattern, name string, handler HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	return g.handle(name, http.MethodDelete, pattern, nil, handler, middleware...)
 }
-func (g *Group) TRACE(pattern, name string, handler HandlerFunc) {
-	g.handle(name, http.MethodTrace, pattern, handler)
+func (g *Group) TRACE(pattern, name string, handler HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	return g.handle(name, http.MethodTrace, pattern, nil, handler, middleware...)
 }
 
-func (g *Group) handle(name, method, pattern string, h HandlerFunc) {
+// Any registers the handler on pattern for all the HTTP methods.
+func (g *Group) Any(pattern, name string, handler HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	return g.Match(anyMethods, pattern, name, handler, middleware...)
+}
+
+// Match registers the handler on pattern for the methods.
+func (g *Group) Match(methods []string, pattern, name string, handler HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	meta := new(RouteMeta)
+	for _, method := range methods {
+		g.handle(name, method, pattern, meta, handler, middleware...)
+	}
+	return meta
+}
 
-	if !strings.HasPrefix(pattern, "/") {
-		pattern = "/" + pattern
+func (g *Group) handle(name, method, pattern string, meta *RouteMeta, h HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	r := Route{
+		Method:  method,
+		Host:    g.host,
+		Pattern: joinPath(g.prefix, pattern),
+		Name:    name,
+		Prefix:  g.prefix,
+		Version: g.version,
+		meta:    meta,
 	}
+	return g.jm.addRoute(r, g, h, middleware)
+}
 
-	h = applyMiddleware(h, g.middleware...)
-	pattern = g.prefix + pattern
-	g.jm.handle(name, method, pattern, h)
+// groupPrefix returns the clean prefix with a leading slash and no
+// trailing slash, the root prefix is "".
+func groupPrefix(prefix string) string {
+	prefix = path.Clean("/" + prefix)
+	if prefix == "/" {
+		return ""
+	}
+	return prefix
 }
@@ -2,6 +2,8 @@ package jvmao
 
 import (
 	"net/http"
+	"net/url"
+	"strings"
 )
 
 // HandlerFunc responds to an HTTP request.
@@ -9,6 +11,34 @@ type HandlerFunc func(Context) error
 
 type HTTPErrorHandler func(err error, c Context)
 
+// WrapHandler wraps http.Handler into HandlerFunc.
+func WrapHandler(h http.Handler) HandlerFunc {
+	return func(c Context) error {
+		h.ServeHTTP(c.Response(), c.Request())
+		return nil
+	}
+}
+
+// mountHandler serves h with the rest of the path after the prefix,
+// the value matched by the trailing slash of the mount pattern.
+func mountHandler(h http.Handler) HandlerFunc {
+	return func(c Context) error {
+		r := c.Request()
+		path := "/"
+		if cx, ok := c.(*context); ok && strings.HasSuffix(cx.route.Pattern, "/") && len(cx.values) > 0 {
+			path += cx.values[len(cx.values)-1]
+		}
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = path
+		r2.URL.RawPath = ""
+		h.ServeHTTP(c.Response(), r2)
+		return nil
+	}
+}
+
 func DefaultHttpErrorHandler(err error, c Context) {
 	code := http.StatusInternalServerError
 	if h, ok := err.(*HTTPError); ok {
@@ -35,7 +65,8 @@ func DefaultNotFoundHandler(c Context) error {
 	return c.String(http.StatusNotFound, "not found")
 }
 
+// DefaultMethodNotAllowedHandler returns a 405 HTTPError sent by the
+// HTTPErrorHandler, the Allow header is set before it is called.
 func DefaultMethodNotAllowedHandler(c Context) error {
-	c.Response().Header().Add(HeaderXContentTypeOptions, "nosniff")
-	return c.String(http.StatusMethodNotAllowed, "method not allowed")
+	return NewHTTPError(http.StatusMethodNotAllowed, "method not allowed")
 }
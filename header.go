@@ -19,6 +19,13 @@ const (
 	MIMEApplicationGrpc           = "application/grpc"
 	MIMEApplicationGrpcWeb        = "application/grpc-web"
 	MIMEApplicationGrpcWebText    = "application/grpc-web-text"
+	MIMETextEventStream           = "text/event-stream"
+	MIMEApplicationXML            = "application/xml"
+	MIMEApplicationXMLUTF8        = "application/xml; " + charsetUTF8
+	MIMEApplicationYAML           = "application/yaml"
+	MIMEApplicationMsgPack        = "application/msgpack"
+	MIMEApplicationCBOR           = "application/cbor"
+	MIMEApplicationProtobuf       = "application/x-protobuf"
 )
 
 // Headers
@@ -28,6 +35,7 @@ const (
 	HeaderContentLength        = "content-length"
 	HeaderContentType          = "content-type"
 	HeaderContentDisposition   = "content-disposition"
+	HeaderCacheControl         = "cache-control"
 
 	HeaderAuthorization   = "authorization"
 	HeaderCookie          = "cookie"
@@ -35,10 +43,26 @@ const (
 	HeaderWWWAuthenticate = "www-authenticate"
 
 	HeaderXRealIP             = "x-real-ip"
+	HeaderXForwardedFor       = "x-forwarded-for"
 	HeaderXRequestID          = "x-request-id"
 	HeaderXContentTypeOptions = "x-content-type-options"
 
 	HeaderLocation = "location"
+	HeaderAllow    = "allow"
+	HeaderAccept   = "accept"
+	HeaderVary     = "vary"
+
+	HeaderUpgrade                = "upgrade"
+	HeaderConnection             = "connection"
+	HeaderSecWebSocketKey        = "sec-websocket-key"
+	HeaderSecWebSocketAccept     = "sec-websocket-accept"
+	HeaderSecWebSocketVersion    = "sec-websocket-version"
+	HeaderSecWebSocketProtocol   = "sec-websocket-protocol"
+	HeaderSecWebSocketExtensions = "sec-websocket-extensions"
+
+	// HeaderLastEventID is the id of the last event an EventSource got,
+	// sent when it reconnects.
+	HeaderLastEventID = "last-event-id"
 
 	//Grpc Header
 	HeaderTe                 = "te"
@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
 	"os"
 	"runtime"
+	"strings"
 	"sync"
 )
 
@@ -76,3 +79,30 @@ var (
 	BCyan    = []byte{'\033', '[', '3', '6', ';', '1', 'm'}
 	BWhite   = []byte{'\033', '[', '3', '7', ';', '1', 'm'}
 )
+
+// realIP returns the client IP of r, the proxy headers come first.
+func realIP(r *http.Request) string {
+	if ip := r.Header.Get(HeaderXForwardedFor); ip != "" {
+		if i := strings.IndexByte(ip, ','); i > 0 {
+			return strings.TrimSpace(ip[:i])
+		}
+		return ip
+	}
+	if ip := r.Header.Get(HeaderXRealIP); ip != "" {
+		return ip
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// requestID returns the request id of r, or the one set in the response
+// by a middleware.
+func requestID(r *http.Request, w http.ResponseWriter) string {
+	if id := r.Header.Get(HeaderXRequestID); id != "" {
+		return id
+	}
+	return w.Header().Get(HeaderXRequestID)
+}
@@ -0,0 +1,77 @@
+package jvmao
+
+import (
+	"fmt"
+	"go/token"
+	"net"
+	"strings"
+)
+
+// hostPattern matches the host of requests, such as "api.example.com"
+// or "{tenant}.example.com" whose labels in braces are params.
+type hostPattern struct {
+	raw    string
+	labels []segment
+}
+
+func parseHostPattern(raw string) (*hostPattern, error) {
+	hp := &hostPattern{raw: raw}
+	for _, label := range strings.Split(strings.ToLower(raw), ".") {
+		switch {
+		case label == "":
+			return nil, fmt.Errorf("jvmao: bad host %q: empty label", raw)
+		case label[0] == '{' && label[len(label)-1] == '}':
+			name := label[1 : len(label)-1]
+			if !token.IsIdentifier(name) {
+				return nil, fmt.Errorf("jvmao: bad host %q: bad param name %q", raw, name)
+			}
+			hp.labels = append(hp.labels, segment{s: name, wild: true})
+		case strings.ContainsAny(label, "{}/"):
+			return nil, fmt.Errorf("jvmao: bad host %q: bad label %q", raw, label)
+		default:
+			hp.labels = append(hp.labels, segment{s: label})
+		}
+	}
+	return hp, nil
+}
+
+// wild counts the labels which are params.
+func (hp *hostPattern) wild() int {
+	n := 0
+	for _, l := range hp.labels {
+		if l.wild {
+			n++
+		}
+	}
+	return n
+}
+
+// match reports whether host matches, the captured labels are appended
+// in params.
+func (hp *hostPattern) match(host string, params []param) ([]param, bool) {
+	host = strings.ToLower(stripPort(host))
+	n := len(params)
+	for _, l := range hp.labels {
+		var label string
+		label, host, _ = strings.Cut(host, ".")
+		switch {
+		case label == "":
+			return params[:n], false
+		case l.wild:
+			params = append(params, param{key: l.s, value: label})
+		case l.s != label:
+			return params[:n], false
+		}
+	}
+	if host != "" {
+		return params[:n], false
+	}
+	return params, true
+}
+
+func stripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
@@ -4,13 +4,17 @@ import (
 	ctx "context"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"io/fs"
 	"net"
 	"net/http"
+	"os"
 	"path"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"text/tabwriter"
 	"time"
 
 	"golang.org/x/crypto/acme"
@@ -20,6 +24,19 @@ import (
 	"google.golang.org/grpc"
 )
 
+// anyMethods are the HTTP methods registered by Any.
+var anyMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodConnect,
+	http.MethodOptions,
+	http.MethodTrace,
+}
+
 // New return a instance of Jvmao.
 func New() *Jvmao {
 	jm := &Jvmao{
@@ -33,13 +50,19 @@ func New() *Jvmao {
 		tcpAlivePeriod: time.Minute * 3,
 
 		grpc: NewGrpcHandler(),
-
-		renderer: new(DefaultRenderer),
 	}
+	jm.SetRenderer(nil)
+	jm.SetSerializer(nil)
+	jm.SetStreamOptions(DefaultStreamOptions)
+	encs := defaultEncoders(jm)
+	jm.encoders.Store(&encs)
 	jm.Logger = DefaultLogger()
-	jm.mux = newMux()
+	jm.mux = newMux(jm)
 	jm.mux.httpErrHandler = DefaultHttpErrorHandler
 	jm.mux.notFoundHandler = DefaultNotFoundHandler
+	jm.mux.methodNotAllowedHandler = DefaultMethodNotAllowedHandler
+	jm.mux.notAcceptableHandler = DefaultNotAcceptableHandler
+	jm.mux.pre = newChain(&jm.mwGen, jm.preMiddleware, jm.mux.dispatch).serve
 	return jm
 }
 
@@ -57,38 +80,195 @@ type Jvmao struct {
 
 	tcpAlivePeriod time.Duration
 
+	// mwMu guards the middleware of jm and its groups,
+	// mwGen is bumped when any of them changes.
+	mwMu       sync.RWMutex
+	reloadMu   sync.Mutex
+	mwGen      atomic.Uint64
 	middleware []MiddlewareFunc
-	renderer   Renderer
+	pre        []MiddlewareFunc
+	renderer   atomic.Pointer[Renderer]
+	serializer atomic.Pointer[Serializer]
+	streamOpts atomic.Pointer[StreamOptions]
+	encoders   atomic.Pointer[[]encoder]
 	Logger     *Logger
 
-	debug bool
+	// debug is read while serving, out of mu held by Start.
+	debug atomic.Bool
 }
 
 func (jm *Jvmao) SetNotFoundHandler(h HandlerFunc) {
+	jm.mux.mu.Lock()
+	defer jm.mux.mu.Unlock()
 	jm.mux.notFoundHandler = h
 }
 
 func (jm *Jvmao) SetHTTPErrorHandler(h HTTPErrorHandler) {
+	jm.mux.mu.Lock()
+	defer jm.mux.mu.Unlock()
 	jm.mux.httpErrHandler = h
 }
 
+// SetMethodNotAllowedHandler sets the handler for requests whose path
+// matches a route but the method doesn't, the Allow header is already set
+// when h is called.
+func (jm *Jvmao) SetMethodNotAllowedHandler(h HandlerFunc) {
+	jm.mux.mu.Lock()
+	defer jm.mux.mu.Unlock()
+	jm.mux.methodNotAllowedHandler = h
+}
+
+// SetNotAcceptableHandler sets the handler for requests asking a version
+// no route of the path and method serves.
+func (jm *Jvmao) SetNotAcceptableHandler(h HandlerFunc) {
+	jm.mux.mu.Lock()
+	defer jm.mux.mu.Unlock()
+	jm.mux.notAcceptableHandler = h
+}
+
+// SetVersioning sets how the version of a request is picked for the
+// routes registered in the groups of Version.
+func (jm *Jvmao) SetVersioning(v Versioning) {
+	jm.mux.mu.Lock()
+	defer jm.mux.mu.Unlock()
+	jm.mux.versioning = v
+}
+
+// SetRouter sets the Router matching the request paths, newRouter is
+// called for each host. it is NewServeMuxRouter by default, NewRadixRouter
+// is faster and doesn't allocate.
+func (jm *Jvmao) SetRouter(newRouter func() Router) {
+	if err := jm.mux.SetRouter(newRouter); err != nil {
+		panic(err)
+	}
+}
+
+// SetPathPolicy sets how the request paths matching no route are fixed,
+// it is DefaultPathPolicy by default.
+func (jm *Jvmao) SetPathPolicy(p PathPolicy) {
+	if err := jm.mux.SetPathPolicy(p); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterConstraint registers c with name, patterns use it as
+// "{param:name}" after the registration. "int", "uuid" and "slug" are
+// built in, and any other name is compiled as a regular expression.
+func (jm *Jvmao) RegisterConstraint(name string, c Constraint) {
+	jm.mux.SetConstraint(name, c)
+}
+
+// AutoOptions answers OPTIONS requests with the methods registered on the
+// path when no OPTIONS handler was registered.
+func (jm *Jvmao) AutoOptions(on bool) {
+	jm.mux.mu.Lock()
+	defer jm.mux.mu.Unlock()
+	jm.mux.autoOptions = on
+}
+
 func (jm *Jvmao) RegisterGrpcServer(s *grpc.Server) {
 	jm.mu.Lock()
 	defer jm.mu.Unlock()
 	jm.grpc.RegisterGrpcServer(s)
 }
 
+// SetRenderer sets the Renderer of Context.Render, nil restores
+// the DefaultRenderer.
 func (jm *Jvmao) SetRenderer(r Renderer) {
-	jm.renderer = r
+	if r == nil {
+		r = new(DefaultRenderer)
+	}
+	jm.renderer.Store(&r)
 }
 
+// Renderer returns the Renderer of Context.Render.
+func (jm *Jvmao) Renderer() Renderer {
+	return *jm.renderer.Load()
+}
+
+// SetStreamOptions sets when the streamed responses are flushed,
+// the DefaultStreamOptions are used until then.
+func (jm *Jvmao) SetStreamOptions(o StreamOptions) {
+	jm.streamOpts.Store(&o)
+}
+
+// Use adds middleware running after routing, in the order they are
+// added. they apply to the routes registered before and after.
 func (jm *Jvmao) Use(middleware ...MiddlewareFunc) {
+	jm.mwMu.Lock()
+	defer jm.mwMu.Unlock()
 	jm.middleware = append(jm.middleware, middleware...)
+	jm.mwGen.Add(1)
+}
+
+// Pre adds middleware running before routing, such as rewriting
+// the request path. the errors they return go to the HTTPErrorHandler.
+func (jm *Jvmao) Pre(middleware ...MiddlewareFunc) {
+	jm.mwMu.Lock()
+	defer jm.mwMu.Unlock()
+	jm.pre = append(jm.pre, middleware...)
+	jm.mwGen.Add(1)
+}
+
+func (jm *Jvmao) preMiddleware() []MiddlewareFunc {
+	jm.mwMu.RLock()
+	defer jm.mwMu.RUnlock()
+	return append([]MiddlewareFunc(nil), jm.pre...)
+}
+
+// routeMiddleware returns the middleware of jm, g and its parents,
+// then the route's.
+func (jm *Jvmao) routeMiddleware(g *Group, route []MiddlewareFunc) []MiddlewareFunc {
+	jm.mwMu.RLock()
+	defer jm.mwMu.RUnlock()
+	mws := append([]MiddlewareFunc(nil), jm.middleware...)
+	mws = append(mws, g.stack()...)
+	return append(mws, route...)
 }
 
 func (jm *Jvmao) Group(prefix string) *Group {
-	prefix = strings.Trim(prefix, "/")
-	return &Group{prefix: prefix, jm: jm}
+	return &Group{prefix: groupPrefix(prefix), jm: jm}
+}
+
+// Version returns a group whose routes serve the requests asking version,
+// picked by Versioning. routes of several versions can share the method
+// and pattern, the routes without version serve any version.
+func (jm *Jvmao) Version(version string) *Group {
+	return &Group{version: version, jm: jm}
+}
+
+// Host returns a group whose routes only serve requests to host.
+// labels in braces are params, such as "{tenant}.example.com",
+// read them with Context.ParamValue. requests to host matching no route
+// of the group fall back to the routes of the other hosts they match,
+// from the most specific, then to the routes without host.
+func (jm *Jvmao) Host(host string) *Group {
+	if _, err := parseHostPattern(host); err != nil {
+		panic(err)
+	}
+	return &Group{host: host, jm: jm}
+}
+
+// AutoHead answers HEAD requests with the GET route of the path when no
+// HEAD route was registered, the body is dropped and the Content-Length
+// is kept.
+func (jm *Jvmao) AutoHead(on bool) {
+	jm.mux.mu.Lock()
+	defer jm.mux.mu.Unlock()
+	jm.mux.autoHead = on
+}
+
+// Mount serves h for all the methods under prefix, the prefix is
+// stripped from the request path h gets. h can be another *Jvmao.
+//
+//	jm.Mount("/debug/pprof", http.DefaultServeMux)
+func (jm *Jvmao) Mount(prefix string, h http.Handler, middleware ...MiddlewareFunc) {
+	prefix = groupPrefix(prefix)
+	mh := mountHandler(h)
+	if prefix != "" {
+		jm.Any(prefix, "", mh, middleware...)
+	}
+	jm.Any(prefix+"/", "", mh, middleware...)
 }
 
 func (jm *Jvmao) Static(prefix string, dir string) {
@@ -114,57 +294,147 @@ func (jm *Jvmao) File(file, dir string) {
 	})
 }
 
-func (jm *Jvmao) CONNECT(pattern, name string, handler HandlerFunc) {
-	jm.handle(name, http.MethodConnect, pattern, handler)
+func (jm *Jvmao) CONNECT(pattern, name string, handler HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	return jm.handle(name, http.MethodConnect, pattern, nil, handler, middleware...)
+}
+func (jm *Jvmao) HEAD(pattern, name string, handler HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	return jm.handle(name, http.MethodHead, pattern, nil, handler, middleware...)
+}
+func (jm *Jvmao) OPTIONS(pattern, name string, handler HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	return jm.handle(name, http.MethodOptions, pattern, nil, handler, middleware...)
+}
+func (jm *Jvmao) PATCH(pattern, name string, handler HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	return jm.handle(name, http.MethodPatch, pattern, nil, handler, middleware...)
+}
+func (jm *Jvmao) GET(pattern, name string, handler HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	return jm.handle(name, http.MethodGet, pattern, nil, handler, middleware...)
 }
-func (jm *Jvmao) HEAD(pattern, name string, handler HandlerFunc) {
-	jm.handle(name, http.MethodHead, pattern, handler)
+func (jm *Jvmao) POST(pattern, name string, handler HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	return jm.handle(name, http.MethodPost, pattern, nil, handler, middleware...)
 }
-func (jm *Jvmao) OPTIONS(pattern, name string, handler HandlerFunc) {
-	jm.handle(name, http.MethodOptions, pattern, handler)
+func (jm *Jvmao) PUT(pattern, name string, handler HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	return jm.handle(name, http.MethodPut, pattern, nil, handler, middleware...)
 }
-func (jm *Jvmao) PATCH(pattern, name string, handler HandlerFunc) {
-	jm.handle(name, http.MethodPatch, pattern, handler)
+func (jm *Jvmao) DELETE(pattern, name string, handler HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	return jm.handle(name, http.MethodDelete, pattern, nil, handler, middleware...)
 }
-func (jm *Jvmao) GET(pattern, name string, handler HandlerFunc) {
-	jm.handle(name, http.MethodGet, pattern, handler)
+
+func (jm *Jvmao) TRACE(pattern, name string, handler HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	return jm.handle(name, http.MethodTrace, pattern, nil, handler, middleware...)
+}
+
+// Any registers the handler on pattern for all the HTTP methods.
+func (jm *Jvmao) Any(pattern, name string, handler HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	return jm.Match(anyMethods, pattern, name, handler, middleware...)
 }
-func (jm *Jvmao) POST(pattern, name string, handler HandlerFunc) {
-	jm.handle(name, http.MethodPost, pattern, handler)
+
+// Match registers the handler on pattern for the methods.
+func (jm *Jvmao) Match(methods []string, pattern, name string, handler HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	meta := new(RouteMeta)
+	for _, method := range methods {
+		jm.handle(name, method, pattern, meta, handler, middleware...)
+	}
+	return meta
+}
+
+func (jm *Jvmao) handle(name, method, pattern string, meta *RouteMeta, h HandlerFunc, middleware ...MiddlewareFunc) *RouteMeta {
+	return jm.addRoute(Route{Method: method, Pattern: pattern, Name: name, meta: meta}, nil, h, middleware)
+}
+
+// addRoute registers h on the route of g, the middleware is resolved
+// when serving. it panics with a descriptive error when the pattern is
+// malformed or conflicts with a registered route.
+func (jm *Jvmao) addRoute(r Route, g *Group, h HandlerFunc, middleware []MiddlewareFunc) *RouteMeta {
+
+	if r.Method == "" {
+		r.Method = http.MethodGet
+	}
+	r.Pattern = joinPath("", r.Pattern)
+	if r.meta == nil {
+		r.meta = new(RouteMeta)
+	}
+	stack := func() []MiddlewareFunc { return jm.routeMiddleware(g, middleware) }
+	if err := jm.mux.Add(r, g, newChain(&jm.mwGen, stack, h)); err != nil {
+		panic(err)
+	}
+	return r.meta
 }
-func (jm *Jvmao) PUT(pattern, name string, handler HandlerFunc) {
-	jm.handle(name, http.MethodPut, pattern, handler)
+
+// RemoveRoute removes the routes with name while serving,
+// the requests being served finish with the removed routes.
+func (jm *Jvmao) RemoveRoute(name string) error {
+	return jm.mux.Remove(name)
 }
-func (jm *Jvmao) DELETE(pattern, name string, handler HandlerFunc) {
-	jm.handle(name, http.MethodDelete, pattern, handler)
+
+// ReplaceRoute replaces the handler of the routes with name while
+// serving, the middleware of the routes are kept.
+func (jm *Jvmao) ReplaceRoute(name string, h HandlerFunc) error {
+	return jm.mux.Replace(name, h)
 }
 
-func (jm *Jvmao) TRACE(pattern, name string, handler HandlerFunc) {
-	jm.handle(name, http.MethodTrace, pattern, handler)
+// ReloadRoutes replaces all the routes with the routes fn registers on jm.
+// the old routes keep serving until fn returns, then the new ones are
+// swapped in at once. the old routes are kept when fn panics, such as
+// registering a bad pattern, and the panic is returned as error.
+// fn must only register routes: the middleware of Use and Pre and the
+// not found handlers of the groups are kept by the reloads, calling
+// them in fn adds them again on every reload.
+//
+//	err := jm.ReloadRoutes(func(jm *jvmao.Jvmao) {
+//		jm.GET("/", "home", home)
+//		plugins.Register(jm)
+//	})
+func (jm *Jvmao) ReloadRoutes(fn func(jm *Jvmao)) (err error) {
+	jm.reloadMu.Lock()
+	defer jm.reloadMu.Unlock()
+
+	jm.mux.Begin()
+	defer func() {
+		if rvr := recover(); rvr != nil {
+			jm.mux.Rollback()
+			if e, ok := rvr.(error); ok {
+				err = e
+			} else {
+				err = fmt.Errorf("jvmao: reload routes: %v", rvr)
+			}
+			return
+		}
+		jm.mux.Commit()
+	}()
+	fn(jm)
+	return nil
 }
 
-func (jm *Jvmao) handle(_, method, pattern string, h HandlerFunc) {
+// Routes returns all the registered routes in registration order.
+func (jm *Jvmao) Routes() []Route {
+	return jm.mux.routes().Routes()
+}
 
-	if method == "" {
-		method = http.MethodGet
+// printRoutes writes the route table in w.
+func (jm *Jvmao) printRoutes(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tHOST\tPATTERN\tNAME\tPREFIX\tVERSION\tMIDDLEWARE")
+	for _, r := range jm.Routes() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%d\n", r.Method, r.Host, r.Pattern, r.Name, r.Prefix, r.Version, r.Middleware)
 	}
-	p := fmt.Sprintf("%s %s", method, pattern)
-	h = applyMiddleware(h, jm.middleware...)
-	jm.mux.Handle(p, method, h)
+	_ = tw.Flush()
+}
+
+// Reverse returns the path of the named route with params filled in order.
+// it returns an error when the route is unknown or the params
+// don't fit the pattern.
+func (jm *Jvmao) Reverse(name string, params ...string) (string, error) {
+	return jm.mux.routes().Reverse(name, params...)
 }
 
 // Debug show debug is open or not.
 func (jm *Jvmao) Debug() bool {
-	jm.mu.Lock()
-	defer jm.mu.Unlock()
-	return jm.debug
+	return jm.debug.Load()
 }
 
 // Opendebug open debug.
 func (jm *Jvmao) OpenDebug() {
-	jm.mu.Lock()
-	defer jm.mu.Unlock()
-	jm.debug = true
+	jm.debug.Store(true)
 	// jm.Logger.SetPriority(LOG_PRINT)
 }
 
@@ -180,6 +450,9 @@ func (jm *Jvmao) SetTCPAlivePeriod(d time.Duration) {
 func (jm *Jvmao) Start(addr string) error {
 	jm.mu.Lock()
 	defer jm.mu.Unlock()
+	if jm.debug.Load() {
+		jm.printRoutes(os.Stdout)
+	}
 
 	h2s := new(http2.Server)
 	jm.hs.Addr = addr
@@ -194,9 +467,14 @@ func (jm *Jvmao) Start(addr string) error {
 }
 
 // StartTLS start an HTTPS server.
+// the WebSockets over its HTTP/2 need GODEBUG=http2xconnect=1, without
+// it the clients fall back to HTTP/1.1 or fail, see Upgrade.
 func (jm *Jvmao) StartTLS(addr string, certFile, keyFile string) error {
 	jm.mu.Lock()
 	defer jm.mu.Unlock()
+	if jm.debug.Load() {
+		jm.printRoutes(os.Stdout)
+	}
 
 	jm.tlsHs.Addr = addr
 	jm.tlsHs.Handler = jm
@@ -222,6 +500,9 @@ func (jm *Jvmao) StartTLS(addr string, certFile, keyFile string) error {
 func (jm *Jvmao) StartAutoTLS(addr string) error {
 	jm.mu.Lock()
 	defer jm.mu.Unlock()
+	if jm.debug.Load() {
+		jm.printRoutes(os.Stdout)
+	}
 
 	jm.tlsHs.Addr = addr
 	jm.tlsHs.Handler = jm
@@ -1,19 +1,375 @@
 package jvmao
 
 import (
+	"bytes"
+	ctx "context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestJm(t *testing.T) {
 
 	jm := New()
 
-	jm.GET("home", "/:id/:name", func(c Context) error { return nil })
-	jm.GET("home1", "/:id/name", func(c Context) error { return nil })
+	jm.GET("/:id/:name", "home", func(c Context) error { return nil })
+	jm.GET("/:id/name", "home1", func(c Context) error { return nil })
 
-	// assert.Equal()
-	// home := jm.Reverse("home", "123", "arion")
-	// home1 := jm.Reverse("home1", "123")
-	// fmt.Println(home, home1)
+	home, err := jm.Reverse("home", "123", "arion")
+	if err != nil || home != "/123/arion" {
+		t.Fatal("Reverse home:", home, err)
+	}
+	home1, err := jm.Reverse("home1", "123")
+	if err != nil || home1 != "/123/name" {
+		t.Fatal("Reverse home1:", home1, err)
+	}
+}
+
+func TestReverse(t *testing.T) {
+
+	jm := New()
+	h := func(c Context) error { return nil }
+
+	g := jm.Group("/api/")
+	g.GET("/posts/{id}", "post", h)
+	g.Group("v1").GET("/files/{path...}", "file", h)
+
+	cases := []struct {
+		name   string
+		params []string
+		want   string
+		err    bool
+	}{
+		{"post", []string{"a b"}, "/api/posts/a%20b", false},
+		{"file", []string{"a/b c.txt"}, "/api/v1/files/a/b%20c.txt", false},
+		{"post", nil, "", true},
+		{"post", []string{"1", "2"}, "", true},
+		{"nope", nil, "", true},
+	}
+	for _, cs := range cases {
+		got, err := jm.Reverse(cs.name, cs.params...)
+		if (err != nil) != cs.err || got != cs.want {
+			t.Fatalf("Reverse(%q, %v) = %q, %v", cs.name, cs.params, got, err)
+		}
+	}
+}
+
+func TestRoutes(t *testing.T) {
+
+	jm := New()
+	h := func(c Context) error { return nil }
+	m := func(next HandlerFunc) HandlerFunc { return next }
+
+	jm.Use(m)
+	jm.GET("/", "index", h)
+	g := jm.Group("/admin")
+	g.Use(m)
+	g.POST("/users", "users", h).Tag("admin")
+
+	routes := jm.Routes()
+	if len(routes) != 2 {
+		t.Fatal("Routes:", routes)
+	}
+	if !routes[1].HasTag("admin") || routes[0].HasTag("admin") {
+		t.Fatal("Routes: tags", routes[0].Tags(), routes[1].Tags())
+	}
+	want := Route{Method: "POST", Pattern: "/admin/users", Name: "users", Prefix: "/admin", Middleware: 2, meta: routes[1].meta}
+	if routes[1] != want {
+		t.Fatalf("Routes: got %+v, want %+v", routes[1], want)
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+
+	var trace []string
+	mw := func(name string) MiddlewareFunc {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(c Context) error {
+				trace = append(trace, name)
+				return next(c)
+			}
+		}
+	}
+
+	jm := New()
+	jm.Use(mw("a"), mw("b"))
+	g := jm.Group("/g")
+	g.GET("/x", "x", func(c Context) error {
+		trace = append(trace, "handler")
+		return nil
+	}, mw("route"))
+	// added after the route was registered.
+	g.Use(mw("group"))
+	jm.Use(mw("c"))
+	jm.Pre(func(next HandlerFunc) HandlerFunc {
+		return func(c Context) error {
+			trace = append(trace, "pre")
+			c.Request().URL.Path = "/g" + c.Request().URL.Path
+			return next(c)
+		}
+	})
+
+	rec := httptest.NewRecorder()
+	jm.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/x", nil))
+
+	want := "pre a b c group route handler"
+	if got := strings.Join(trace, " "); got != want {
+		t.Fatalf("middleware order: got %q, want %q", got, want)
+	}
+}
+
+func TestMount(t *testing.T) {
+
+	sub := New()
+	sub.GET("/", "sub-index", func(c Context) error { return c.String(http.StatusOK, "sub index") })
+	sub.POST("/users/:id", "sub-user", func(c Context) error { return c.String(http.StatusOK, "sub "+c.ParamValue("id")) })
+
+	std := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Wrapped", r.Header.Get("X-Std"))
+		_, _ = w.Write([]byte("std " + r.URL.Path))
+	})
+
+	type swapWriter struct{ http.ResponseWriter }
+
+	jm := New()
+	jm.AutoHead(true)
+	jm.Mount("/sub", sub)
+	jm.Group("/api").Mount("/std", std)
+	jm.GET("/wrap", "wrap", WrapHandler(std), WrapMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Set("X-Std", "yes")
+			next.ServeHTTP(w, r)
+		})
+	}))
+
+	jm.GET("/swap", "swap", WrapHandler(std), WrapMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(swapWriter{w}, r)
+		})
+	}))
+
+	cases := []struct {
+		method, target, body string
+	}{
+		{http.MethodGet, "/sub", "sub index"},
+		{http.MethodPost, "/sub/users/7", "sub 7"},
+		{http.MethodDelete, "/api/std/a/b", "std /a/b"},
+		{http.MethodGet, "/wrap", "std /wrap"},
+	}
+	for _, cs := range cases {
+		rec := httptest.NewRecorder()
+		jm.ServeHTTP(rec, httptest.NewRequest(cs.method, cs.target, nil))
+		if rec.Body.String() != cs.body {
+			t.Fatalf("%s %s: %d %q", cs.method, cs.target, rec.Code, rec.Body.String())
+		}
+	}
+	rec := httptest.NewRecorder()
+	jm.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/wrap", nil))
+	if rec.Header().Get("X-Wrapped") != "yes" {
+		t.Fatal("WrapMiddleware:", rec.Header())
+	}
+
+	// the head response is kept when the writer is swapped.
+	rec = httptest.NewRecorder()
+	jm.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/swap", nil))
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 || rec.Header().Get(HeaderContentLength) != "9" {
+		t.Fatal("WrapMiddleware head:", rec.Code, rec.Header(), rec.Body)
+	}
+	// the path fixed by the PathPolicy is stripped.
+	jm.SetPathPolicy(PathPolicy{Mode: PathTolerant, CleanPath: true, CaseInsensitive: true})
+	for target, body := range map[string]string{
+		"/SUB/users/7":      "sub 7",
+		"/a/../sub/users/7": "sub 7",
+		"/API/Std/a/b":      "std /a/b",
+	} {
+		rec := httptest.NewRecorder()
+		jm.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, nil))
+		if rec.Body.String() != body {
+			t.Fatalf("POST %s: %d %q", target, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestRouteMeta(t *testing.T) {
+
+	jm := New()
+	var got []string
+	jm.Use(func(next HandlerFunc) HandlerFunc {
+		return func(c Context) error {
+			if r := c.Route(); r != nil {
+				scope, _ := r.Meta("scope").(string)
+				got = append(got, r.Method+" "+r.Pattern+" "+r.Name+" "+scope+" "+strings.Join(r.Tags(), ","))
+			}
+			return next(c)
+		}
+	})
+	h := func(c Context) error { return c.NoContent(http.StatusOK) }
+	jm.GET("/users/{id}", "user", h).Set("scope", "users:read").Tag("users", "public")
+	jm.Match([]string{http.MethodPut, http.MethodPatch}, "/users/{id}", "update-user", h).Set("scope", "users:write")
+
+	for _, method := range []string{http.MethodGet, http.MethodPatch, http.MethodDelete} {
+		jm.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/users/1", nil))
+	}
+	want := []string{
+		"GET /users/{id} user users:read users,public",
+		"PATCH /users/{id} update-user users:write ",
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatal("route meta:", got)
+	}
+}
+
+func TestContextLogger(t *testing.T) {
+
+	buf := new(bytes.Buffer)
+	jm := New()
+	jm.Logger = &Logger{slog.New(slog.NewJSONHandler(buf, nil))}
+	jm.Pre(func(next HandlerFunc) HandlerFunc {
+		return func(c Context) error {
+			c.Logger().Info("pre")
+			return next(c)
+		}
+	})
+	jm.Use(func(next HandlerFunc) HandlerFunc {
+		return func(c Context) error {
+			c.SetLogger(c.Logger().With("user", "u1"))
+			return next(c)
+		}
+	})
+	jm.SetHTTPErrorHandler(func(err error, c Context) {
+		c.Logger().Error("failed", "error", err)
+		_ = c.NoContent(http.StatusInternalServerError)
+	})
+	jm.GET("/users/{id}", "user", func(c Context) error {
+		c.Logger().Info("hello")
+		return errors.New("boom")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.Header.Set(HeaderXRequestID, "r1")
+	req.Header.Set(HeaderXForwardedFor, "10.0.0.1, 10.0.0.2")
+	jm.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], `"route":""`) {
+		t.Fatal("logs:", buf)
+	}
+	// the logger got before routing is rebuilt with the route.
+	for _, line := range lines[1:] {
+		var rec map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec["request_id"] != "r1" || rec["method"] != "GET" || rec["path"] != "/users/1" ||
+			rec["route"] != "user" || rec["remote_ip"] != "10.0.0.1" || rec["user"] != "u1" {
+			t.Fatal("log record:", line)
+		}
+	}
+}
+
+type ctxKey struct{}
+
+func TestContextContext(t *testing.T) {
+
+	jm := New()
+	lookup := func(cx ctx.Context, key any) any { return cx.Value(key) }
+	jm.Use(func(next HandlerFunc) HandlerFunc {
+		return func(c Context) error {
+			cx, cancel := ctx.WithTimeout(ctx.WithValue(c.Request().Context(), ctxKey{}, "lib"), time.Hour)
+			defer cancel()
+			c.WithContext(cx)
+			return next(c)
+		}
+	})
+	jm.GET("/", "index", func(c Context) error {
+		c.Set("user", "u1")
+		if _, ok := c.Deadline(); !ok || c.Err() != nil {
+			t.Fatal("deadline:", c.Err())
+		}
+		if lookup(c, "user") != "u1" || lookup(c, ctxKey{}) != "lib" || lookup(c.Request().Context(), ctxKey{}) != "lib" {
+			t.Fatal("value:", lookup(c, "user"), lookup(c, ctxKey{}))
+		}
+		if lookup(c, struct{}{}) != nil {
+			t.Fatal("missing key:", lookup(c, struct{}{}))
+		}
+		return c.NoContent(http.StatusOK)
+	})
+	jm.GET("/get", "get", func(c Context) error {
+		c.WithContext(ctx.WithValue(c.Request().Context(), "tenant", "t1"))
+		if c.Get("tenant") != "t1" {
+			t.Fatal("get falls back:", c.Get("tenant"))
+		}
+		return c.NoContent(http.StatusOK)
+	})
+
+	jm.GET("/loop", "loop", func(c Context) (err error) {
+		defer func() {
+			if recover() == nil {
+				err = errors.New("no panic")
+			}
+		}()
+		c.WithContext(ctx.WithValue(c, ctxKey{}, "lib"))
+		return nil
+	})
+
+	for _, target := range []string{"/", "/get", "/loop"} {
+		rec := httptest.NewRecorder()
+		jm.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatal(target, rec.Code)
+		}
+	}
+
+	cx, cancel := ctx.WithCancel(ctx.Background())
+	cancel()
+	jm.GET("/done", "done", func(c Context) error {
+		<-c.Done()
+		return c.Err()
+	})
+	rec := httptest.NewRecorder()
+	jm.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/done", nil).WithContext(cx))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatal("canceled:", rec.Code)
+	}
+}
+
+func TestTypedValues(t *testing.T) {
+
+	type user struct{ name string }
+	userKey := NewKey[*user]("user")
+	otherKey := NewKey[*user]("user")
+	countKey := NewKey[int]("count")
+
+	jm := New()
+	jm.Use(func(next HandlerFunc) HandlerFunc {
+		return func(c Context) error {
+			SetValue(c, userKey, &user{"u1"})
+			SetValue(c, countKey, 2)
+			return next(c)
+		}
+	})
+	jm.GET("/", "index", func(c Context) error {
+		u, ok := Value(c, userKey)
+		if !ok || u.name != "u1" {
+			t.Fatal("value:", u, ok)
+		}
+		if n, ok := Value(c.Request().Context(), countKey); !ok || n != 2 {
+			t.Fatal("request context value:", n, ok)
+		}
+		if _, ok := Value(c, otherKey); ok {
+			t.Fatal("keys of the same name collide")
+		}
+		return c.NoContent(http.StatusOK)
+	})
 
+	rec := httptest.NewRecorder()
+	jm.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatal(rec.Code)
+	}
 }
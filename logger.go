@@ -82,6 +82,11 @@ func newHandler(opt LogOptions) slog.Handler {
 
 }
 
+// With returns a Logger with the attributes added in each record.
+func (l *Logger) With(args ...any) *Logger {
+	return &Logger{l.Logger.With(args...)}
+}
+
 type LogOptions struct {
 	Format      string // log type json or text
 	Level       Level
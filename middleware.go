@@ -1,11 +1,76 @@
 package jvmao
 
+import (
+	"net/http"
+	"sync/atomic"
+)
+
 // MiddlewareFunc ...
 type MiddlewareFunc func(HandlerFunc) HandlerFunc
 
+// WrapMiddleware wraps func(http.Handler) http.Handler into MiddlewareFunc.
+// the request and the response writer m passes on are used by the
+// next handlers, the response is restored after them.
+func WrapMiddleware(m func(http.Handler) http.Handler) MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c Context) (err error) {
+			res := c.Response()
+			m(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				c.SetRequest(r)
+				if w != res {
+					c.SetResponse(NewResponse(w))
+					defer c.SetResponse(res)
+				}
+				err = next(c)
+			})).ServeHTTP(res, c.Request())
+			return
+		}
+	}
+}
+
+// applyMiddleware wraps h with middleware, the first one runs first.
 func applyMiddleware(h HandlerFunc, middleware ...MiddlewareFunc) HandlerFunc {
-	for _, m := range middleware {
-		h = m(h)
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
 	}
 	return h
 }
+
+// chain wraps h with the middleware of stack when serving, it is built
+// again after the generation changes, so the middleware added by Use
+// after a route was registered applies to it.
+type chain struct {
+	gen   *atomic.Uint64
+	stack func() []MiddlewareFunc
+	h     HandlerFunc
+	built atomic.Pointer[builtChain]
+}
+
+type builtChain struct {
+	gen uint64
+	h   HandlerFunc
+}
+
+func newChain(gen *atomic.Uint64, stack func() []MiddlewareFunc, h HandlerFunc) *chain {
+	return &chain{gen: gen, stack: stack, h: h}
+}
+
+// with returns a chain of the same middleware serving h.
+func (c *chain) with(h HandlerFunc) *chain {
+	return newChain(c.gen, c.stack, h)
+}
+
+// serve is the HandlerFunc of the chain.
+func (c *chain) serve(ctx Context) error {
+	return c.handler()(ctx)
+}
+
+func (c *chain) handler() HandlerFunc {
+	gen := c.gen.Load()
+	if b := c.built.Load(); b != nil && b.gen == gen {
+		return b.h
+	}
+	b := &builtChain{gen: gen, h: applyMiddleware(c.h, c.stack()...)}
+	c.built.Store(b)
+	return b.h
+}
@@ -12,6 +12,15 @@ import (
 
 var theJWTManager *JWTManager
 
+// ClaimsKey is the key of the claims data of the verified token,
+// read it with Claims or jvmao.Value.
+var ClaimsKey = jvmao.NewKey[interface{}]("jwt")
+
+// Claims returns the claims data of the verified token.
+func Claims(c jvmao.Context) (interface{}, bool) {
+	return jvmao.Value(c, ClaimsKey)
+}
+
 type JWTMiddlewareOption struct {
 	Secret        string
 	TokenDuration time.Duration
@@ -36,6 +45,8 @@ func JWTMiddleware(h jvmao.HandlerFunc) jvmao.HandlerFunc {
 			return ctx.Error(401, errors.New("Unauthorized"))
 		}
 
+		jvmao.SetValue(ctx, ClaimsKey, claims)
+		// the "jwt" key is kept for the handlers reading it.
 		ctx.Set("jwt", claims)
 
 		return h(ctx)
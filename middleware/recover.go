@@ -1,7 +1,6 @@
 package middleware
 
 import (
-	"errors"
 	"fmt"
 	"net/http"
 	"runtime/debug"
@@ -27,11 +26,14 @@ func Recover() jvmao.MiddlewareFunc {
 					}
 
 					stack := debug.Stack()
-					s := fmt.Sprintf("[PANIC RECOVER] %v %s\n", err, stack)
+					c.Logger().Error("panic recovered", "error", err, "stack", string(stack))
 
-					// c.Logger().Error(s)
-
-					_ = c.Json(http.StatusInternalServerError, errors.New(s))
+					// the panic is only shown in debug mode.
+					msg := http.StatusText(http.StatusInternalServerError)
+					if c.Debug() {
+						msg = fmt.Sprintf("[PANIC RECOVER] %v %s", err, stack)
+					}
+					_ = c.Json(http.StatusInternalServerError, jvmao.NewHTTPError(http.StatusInternalServerError, msg))
 
 				}
 			}()
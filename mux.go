@@ -1,49 +1,629 @@
 package jvmao
 
 import (
+	"fmt"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
 )
 
 type mux struct {
-	serverMux       *http.ServeMux
 	mu              sync.RWMutex
 	pool            sync.Pool
-	route           *routeChache
+	constraints     map[string]Constraint
 	notFoundHandler HandlerFunc
 	httpErrHandler  HTTPErrorHandler
+	// groupNotFound are the not found handlers of the groups by host
+	// then prefix, host "" is the routes without host.
+	groupNotFound map[string]map[string]HandlerFunc
+
+	// table is the routes serving, staging collects the routes
+	// to replace it while reloading.
+	table   *routeTable
+	staging *routeTable
+
+	// newRouter returns the Router of each host.
+	newRouter func() Router
+
+	methodNotAllowedHandler HandlerFunc
+	autoOptions             bool
+	autoHead                bool
+	notAcceptableHandler    HandlerFunc
+	versioning              Versioning
+	policy                  PathPolicy
+
+	// pre runs before routing, it ends with dispatch.
+	pre HandlerFunc
 }
 
-// newMux returns a new Mux object.
-func newMux() *mux {
+// newMux returns a new Mux object serving the contexts of jm.
+func newMux(jm *Jvmao) *mux {
 	mux := &mux{
-		serverMux: http.NewServeMux(),
-		mu:        sync.RWMutex{},
-		route:     newRouteChache(),
+		mu:            sync.RWMutex{},
+		constraints:   defaultConstraints(),
+		groupNotFound: map[string]map[string]HandlerFunc{},
+		newRouter:     NewServeMuxRouter,
+		policy:        DefaultPathPolicy,
 	}
+	mux.table = mux.newTable()
+	mux.pre = mux.dispatch
 
-	mux.pool = sync.Pool{New: func() interface{} { return &context{w: NewResponse(nil), route: mux.route} }}
+	mux.pool = sync.Pool{New: func() interface{} { return &context{w: NewResponse(nil), mux: mux, jm: jm} }}
 	return mux
 }
 
-func (m *mux) SetRoute(name, pattern string) {
-	m.route.SetRoute(name, pattern)
+// routeTable holds the routes of all hosts. routes are added in place,
+// the table is built again and swapped when routes are removed.
+type routeTable struct {
+	route *routeChache
+	// def serves the routes without host, hosts are tried before it.
+	def   *hostMux
+	hosts []*hostMux
+}
+
+func (m *mux) newTable() *routeTable {
+	return &routeTable{route: newRouteChache(), def: newHostMux(m, nil)}
+}
+
+// hostMux holds the routes of a host.
+type hostMux struct {
+	m      *mux
+	host   *hostPattern
+	router Router
+	// policy is the PathPolicy of the mux when hm was built.
+	policy PathPolicy
+	// fold finds the patterns in lower case with
+	// PathPolicy.CaseInsensitive.
+	fold    Router
+	entries map[string]*entry
+}
+
+func newHostMux(m *mux, host *hostPattern) *hostMux {
+	hm := &hostMux{
+		m:       m,
+		host:    host,
+		router:  m.newRouter(),
+		policy:  m.policy,
+		entries: map[string]*entry{},
+	}
+	if hm.policy.CaseInsensitive {
+		hm.fold = m.newRouter()
+	}
+	return hm
+}
+
+// entry holds the handlers registered on the same pattern by method.
+type entry struct {
+	hm       *hostMux
+	pattern  *routePattern
+	handlers map[string][]*muxRoute
+	// methods in registration order, used for the Allow header.
+	methods []string
+	// versioned reports whether a route has a version.
+	versioned bool
+}
+
+// muxRoute is a handler with the param names of its pattern.
+type muxRoute struct {
+	route   *Route
+	group   *Group
+	pattern *routePattern
+	params  []string
+	version string
+	h       HandlerFunc
+}
+
+// routes returns the routes registered, or being registered while
+// reloading.
+func (m *mux) routes() *routeChache {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.staging != nil {
+		return m.staging.route
+	}
+	return m.table.route
 }
 
-// Handle registers the handler for the given pattern.
-func (m *mux) Handle(pattern, method string, handlerFunc HandlerFunc) {
+// SetConstraint registers c used by the patterns as "{param:name}".
+func (m *mux) SetConstraint(name string, c Constraint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.constraints[name] = c
+}
 
-	m.serverMux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
-		ctx := m.pool.Get().(*context)
-		defer m.pool.Put(ctx)
-		ctx.reset(w, r)
-		err := handlerFunc(ctx)
+// SetGroupNotFoundHandler sets the not found handler of the paths under
+// prefix of host, "" is the routes without host.
+func (m *mux) SetGroupNotFoundHandler(host, prefix string, h HandlerFunc) error {
+	if host != "" {
+		hp, err := parseHostPattern(host)
 		if err != nil {
-			m.httpErrHandler(err, ctx)
+			return err
+		}
+		host = hp.raw
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.groupNotFound[host] == nil {
+		m.groupNotFound[host] = map[string]HandlerFunc{}
+	}
+	m.groupNotFound[host][prefix] = h
+	return nil
+}
+
+// hostMux returns the hostMux of host, creates it when missing.
+func (t *routeTable) hostMux(m *mux, host string) (*hostMux, error) {
+	if host == "" {
+		return t.def, nil
+	}
+	hp, err := parseHostPattern(host)
+	if err != nil {
+		return nil, err
+	}
+	for _, hm := range t.hosts {
+		if hm.host.raw == hp.raw {
+			return hm, nil
 		}
+	}
+	hm := newHostMux(m, hp)
+	t.hosts = append(t.hosts, hm)
+	// the hosts with less params are tried first.
+	sort.SliceStable(t.hosts, func(i, j int) bool {
+		return t.hosts[i].host.wild() < t.hosts[j].host.wild()
 	})
+	return hm, nil
+}
+
+// Add registers the route served by ch.
+// it returns an error when the pattern is malformed or conflicts with
+// a registered one.
+func (m *mux) Add(r Route, g *Group, ch *chain) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.table
+	if m.staging != nil {
+		t = m.staging
+	}
+	return t.add(m, routeRecord{r, g, ch})
+}
+
+func (t *routeTable) add(m *mux, rec routeRecord) error {
+	hm, err := t.hostMux(m, rec.Host)
+	if err != nil {
+		return err
+	}
+	p, err := parsePattern(rec.Pattern, m.constraint)
+	if err != nil {
+		return err
+	}
+	h := rec.chain.serve
+	if rec.group != nil {
+		h = rec.group.handleError(h)
+	}
+	if err := hm.handle(p, &rec.Route, rec.group, h); err != nil {
+		return err
+	}
+	t.route.AddRoute(rec)
+	return nil
+}
+
+// rebuild swaps in a table built with the records, requests being served
+// finish with the old table.
+func (m *mux) rebuild(records []routeRecord) error {
+	t := m.newTable()
+	for _, rec := range records {
+		if err := t.add(m, rec); err != nil {
+			return err
+		}
+	}
+	m.table = t
+	return nil
+}
+
+// Remove removes the routes with name.
+func (m *mux) Remove(name string) error {
+	if name == "" {
+		return fmt.Errorf("jvmao: remove a route without name")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var records []routeRecord
+	for _, rec := range m.table.route.records() {
+		if rec.Name != name {
+			records = append(records, rec)
+		}
+	}
+	if len(records) == len(m.table.route.routes) {
+		return fmt.Errorf("jvmao: route %q not found", name)
+	}
+	return m.rebuild(records)
+}
+
+// Replace replaces the handler of the routes with name, the middleware
+// of the routes are kept.
+func (m *mux) Replace(name string, h HandlerFunc) error {
+	if name == "" {
+		return fmt.Errorf("jvmao: replace a route without name")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := false
+	records := m.table.route.records()
+	for i, rec := range records {
+		if rec.Name == name {
+			records[i].chain = rec.chain.with(h)
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("jvmao: route %q not found", name)
+	}
+	return m.rebuild(records)
+}
+
+// SetRouter sets the Router of the hosts, the routes registered are
+// added to the new Routers.
+func (m *mux) SetRouter(newRouter func() Router) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old := m.newRouter
+	m.newRouter = newRouter
+	if err := m.rebuild(m.table.route.records()); err != nil {
+		m.newRouter = old
+		return err
+	}
+	return nil
+}
+
+// SetPathPolicy sets the policy fixing the request paths.
+func (m *mux) SetPathPolicy(p PathPolicy) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old := m.policy
+	m.policy = p
+	if err := m.rebuild(m.table.route.records()); err != nil {
+		m.policy = old
+		return err
+	}
+	return nil
+}
+
+// Begin starts collecting the routes of a new table, they are served
+// after Commit.
+func (m *mux) Begin() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.staging = m.newTable()
+}
+
+// Commit swaps in the table collected since Begin,
+// Rollback drops it.
+func (m *mux) Commit() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.table, m.staging = m.staging, nil
+}
+
+func (m *mux) Rollback() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.staging = nil
+}
+
+func (hm *hostMux) handle(p *routePattern, r *Route, g *Group, handlerFunc HandlerFunc) error {
+	method, version := r.Method, r.Version
+	mp := p.muxPattern()
+	e, ok := hm.entries[mp]
+	if !ok {
+		for _, o := range hm.entries {
+			if p.conflicts(o.pattern) {
+				return fmt.Errorf("jvmao: pattern %q conflicts with registered pattern %q", p.raw, o.pattern.raw)
+			}
+		}
+		e = &entry{hm: hm, pattern: p, handlers: map[string][]*muxRoute{}}
+		if err := hm.router.Add(mp, e); err != nil {
+			return err
+		}
+		hm.entries[mp] = e
+		if hm.fold != nil {
+			// patterns differing in case only are found by the first.
+			_ = hm.fold.Add(strings.ToLower(mp), e)
+		}
+	}
+	mrs, ok := e.handlers[method]
+	if !ok {
+		e.methods = append(e.methods, method)
+	}
+	for _, o := range mrs {
+		if o.pattern.constraints() == p.constraints() && o.version == version {
+			return fmt.Errorf("jvmao: %s %q conflicts with registered %s %q", method, p.raw, method, o.pattern.raw)
+		}
+	}
+	mrs = append(mrs, &muxRoute{route: r, group: g, pattern: p, params: p.params(), version: version, h: handlerFunc})
+	// the more constrained routes are tried first,
+	// then the routes with a version.
+	sort.SliceStable(mrs, func(i, j int) bool {
+		ci, cj := mrs[i].pattern.constrained(), mrs[j].pattern.constrained()
+		if ci != cj {
+			return ci > cj
+		}
+		return mrs[i].version != "" && mrs[j].version == ""
+	})
+	e.handlers[method] = mrs
+	if version != "" {
+		e.versioned = true
+	}
+	return nil
 }
 
 func (m *mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	m.serverMux.ServeHTTP(w, r)
+	ctx := m.acquire(w, r)
+	defer m.pool.Put(ctx)
+	m.handle(ctx, m.pre)
+}
+
+// acquire returns a pooled context reset for the request.
+func (m *mux) acquire(w http.ResponseWriter, r *http.Request) *context {
+	ctx := m.pool.Get().(*context)
+	ctx.reset(w, r)
+	return ctx
+}
+
+// handle runs h, the returned error goes to httpErrHandler.
+func (m *mux) handle(ctx *context, h HandlerFunc) {
+	defer func() {
+		for _, f := range ctx.finish {
+			f()
+		}
+	}()
+	if err := h(ctx); err != nil {
+		m.mu.RLock()
+		eh := m.httpErrHandler
+		m.mu.RUnlock()
+		eh(err, ctx)
+	}
+	ctx.w.finish()
+}
+
+// dispatch routes the request, it runs after the Pre middleware.
+func (m *mux) dispatch(c Context) error {
+	ctx := c.(*context)
+	return m.find(ctx)(ctx)
+}
+
+// find returns the handler for the request of ctx, and sets the params in ctx.
+func (m *mux) find(ctx *context) HandlerFunc {
+	r := ctx.r
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t := m.table
+	path := r.URL.EscapedPath()
+	// the hosts matching the request are tried from the most specific,
+	// its not found handler is used when none has the path.
+	var notFound HandlerFunc
+	for _, hm := range t.hosts {
+		params, ok := hm.host.match(r.Host, ctx.params[:0])
+		if !ok {
+			continue
+		}
+		if notFound == nil {
+			notFound = hm.notFound(path)
+		}
+		if h := hm.find(ctx, params); h != nil {
+			return h
+		}
+	}
+	if notFound == nil {
+		notFound = t.def.notFound(path)
+	}
+	if h := t.def.find(ctx, ctx.params[:0]); h != nil {
+		return h
+	}
+	return notFound
+}
+
+// find returns nil when no route of hm accepts the path of the request,
+// params are the params of the host.
+func (hm *hostMux) find(ctx *context, params []param) HandlerFunc {
+	path := ctx.r.URL.EscapedPath()
+	e := hm.lookup(ctx, path)
+	if e == nil {
+		policy := hm.policy
+		if policy.Mode == PathStrict {
+			return nil
+		}
+		var canonical string
+		if canonical, e = hm.fix(ctx, path); e == nil {
+			return nil
+		}
+		if policy.Mode == PathRedirect && canonical != path {
+			return redirectHandler(policy.RedirectCode, canonical)
+		}
+	}
+	ctx.params = params
+	return e.find(ctx, ctx.values)
+}
+
+// lookup returns the entry of the pattern matching the escaped path,
+// the values of the params are set in ctx.
+func (hm *hostMux) lookup(ctx *context, path string) *entry {
+	var v interface{}
+	v, ctx.values = hm.router.Find(path, ctx.values[:0])
+	e, _ := v.(*entry)
+	return e
+}
+
+// find returns the handler of the request method, the handler of HEAD
+// falls back to GET with AutoHead, a path matching with no route of
+// the method gets the method not allowed handler, and with no route of
+// the version asked the not acceptable handler. it returns nil when
+// the constraints reject the values for all the methods.
+func (e *entry) find(ctx *context, values []string) HandlerFunc {
+	m := e.hm.m
+	method := ctx.r.Method
+	version := ""
+	if e.versioned {
+		version = m.versioning.version(ctx.r)
+	}
+	h, miss := e.match(ctx, method, version, values)
+	if h == nil && method == http.MethodHead && m.autoHead {
+		var getMiss bool
+		if h, getMiss = e.match(ctx, http.MethodGet, version, values); h != nil {
+			ctx.w.head = true
+		}
+		miss = miss || getMiss
+	}
+	// the WebSocket over HTTP/2 is served by the GET route, as over HTTP/1.1.
+	if h == nil && isWebSocketConnect(ctx.r) {
+		var getMiss bool
+		h, getMiss = e.match(ctx, http.MethodGet, version, values)
+		miss = miss || getMiss
+	}
+	if h != nil {
+		return h
+	}
+	if miss {
+		return e.handleError(m.notAcceptableHandler, values)
+	}
+	allow := e.allow(values)
+	if allow == "" {
+		return nil
+	}
+	ctx.w.Header().Set(HeaderAllow, allow)
+	if method == http.MethodOptions && m.autoOptions {
+		return defaultOptionsHandler
+	}
+	return e.handleError(m.methodNotAllowedHandler, values)
+}
+
+// handleError sends the error returned by h to the error handler of
+// the group of the first route accepting values.
+func (e *entry) handleError(h HandlerFunc, values []string) HandlerFunc {
+	probe := &context{}
+	for _, method := range e.methods {
+		for _, mr := range e.handlers[method] {
+			if !mr.match(probe, values) {
+				continue
+			}
+			if mr.group != nil {
+				return mr.group.handleError(h)
+			}
+			return h
+		}
+	}
+	return h
+}
+
+// notFound returns the not found handler of the group with the longest
+// prefix of path, the hosts fall back to the groups without host.
+func (hm *hostMux) notFound(path string) HandlerFunc {
+	if hm.host != nil {
+		if h := hm.m.groupNotFoundHandler(hm.host.raw, path); h != nil {
+			return h
+		}
+	}
+	if h := hm.m.groupNotFoundHandler("", path); h != nil {
+		return h
+	}
+	return hm.m.notFoundHandler
+}
+
+func (m *mux) groupNotFoundHandler(host, path string) HandlerFunc {
+	var h HandlerFunc
+	n := -1
+	for prefix, gh := range m.groupNotFound[host] {
+		if len(prefix) > n && underPrefix(path, prefix) {
+			h, n = gh, len(prefix)
+		}
+	}
+	return h
+}
+
+// underPrefix reports whether path is prefix or under it.
+func underPrefix(path, prefix string) bool {
+	return strings.HasPrefix(path, prefix) &&
+		(len(path) == len(prefix) || path[len(prefix)] == '/')
+}
+
+// match returns the handler of the first route registered on method
+// serving version whose constraints accept values, and sets the params
+// in ctx. miss reports whether a route of another version accepts values.
+func (e *entry) match(ctx *context, method, version string, values []string) (h HandlerFunc, miss bool) {
+	for _, mr := range e.handlers[method] {
+		if mr.version != "" && mr.version != version {
+			if !miss {
+				miss = mr.match(&context{}, values)
+			}
+			continue
+		}
+		if mr.match(ctx, values) {
+			ctx.route = mr.route
+			return mr.h, false
+		}
+	}
+	return nil, miss
+}
+
+// match reports whether the constraints accept values, the params
+// are appended in ctx when they do.
+func (mr *muxRoute) match(ctx *context, values []string) bool {
+	n := len(ctx.params)
+	i := 0
+	for _, seg := range mr.pattern.segs {
+		if !seg.wild {
+			continue
+		}
+		p := param{key: seg.s, value: values[i]}
+		i++
+		if seg.check != nil {
+			v, ok := seg.check(p.value)
+			if !ok {
+				ctx.params = ctx.params[:n]
+				return false
+			}
+			p.typed = v
+		}
+		if p.key != "" {
+			ctx.params = append(ctx.params, p)
+		}
+	}
+	return true
+}
+
+// allow returns the value of the Allow header, the methods which have a
+// route accepting values.
+func (e *entry) allow(values []string) string {
+	var methods []string
+	probe := &context{}
+	for _, method := range e.methods {
+		for _, mr := range e.handlers[method] {
+			if mr.match(probe, values) {
+				methods = append(methods, method)
+				break
+			}
+		}
+	}
+	if len(methods) == 0 {
+		return ""
+	}
+	if _, ok := e.handlers[http.MethodHead]; !ok && e.hm.m.autoHead {
+		for _, method := range methods {
+			if method == http.MethodGet {
+				methods = append(methods, http.MethodHead)
+				break
+			}
+		}
+	}
+	if _, ok := e.handlers[http.MethodOptions]; !ok && e.hm.m.autoOptions {
+		methods = append(methods, http.MethodOptions)
+	}
+	return strings.Join(methods, ", ")
+}
+
+func defaultOptionsHandler(c Context) error {
+	return c.NoContent(http.StatusNoContent)
 }
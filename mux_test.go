@@ -0,0 +1,483 @@
+package jvmao
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestMethodNotAllowed(t *testing.T) {
+
+	jm := New()
+	h := func(c Context) error { return c.String(http.StatusOK, "ok") }
+	jm.GET("/posts", "posts", h)
+	jm.POST("/posts", "create-post", h)
+
+	req := httptest.NewRequest(http.MethodDelete, "/posts", nil)
+	rec := httptest.NewRecorder()
+	jm.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get(HeaderAllow) != "GET, POST" {
+		t.Fatal("method not allowed:", rec.Code, rec.Header())
+	}
+
+	// the 405 is sent by the HTTPErrorHandler.
+	jm.SetHTTPErrorHandler(DefaultHttpJsonErrorHandler)
+	rec = httptest.NewRecorder()
+	jm.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/posts", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get(HeaderAllow) != "GET, POST" ||
+		rec.Header().Get(HeaderContentType) != MIMEApplicationJSONUTF8 {
+		t.Fatal("json method not allowed:", rec.Code, rec.Header(), rec.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/nope", nil)
+	rec = httptest.NewRecorder()
+	jm.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatal("not found:", rec.Code)
+	}
+
+	jm.AutoOptions(true)
+	req = httptest.NewRequest(http.MethodOptions, "/posts", nil)
+	rec = httptest.NewRecorder()
+	jm.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent || rec.Header().Get(HeaderAllow) != "GET, POST, OPTIONS" {
+		t.Fatal("auto options:", rec.Code, rec.Header())
+	}
+}
+
+func TestParamSyntax(t *testing.T) {
+
+	jm := New()
+	h := func(c Context) error {
+		return c.String(http.StatusOK, c.ParamValue("id")+"|"+c.ParamValue("path"))
+	}
+	jm.GET("/posts/:id", "post", h)
+	jm.GET("/posts/new", "new-post", func(c Context) error { return c.String(http.StatusOK, "new") })
+	jm.GET("/files/*path", "files", h)
+	jm.GET("/users/{id}/{path...}", "user-files", h)
+
+	cases := map[string]string{
+		"/posts/12":           "12|",
+		"/posts/new":          "new",
+		"/files/a/b.txt":      "|a/b.txt",
+		"/users/7/docs/x.pdf": "7|docs/x.pdf",
+	}
+	for target, want := range cases {
+		rec := httptest.NewRecorder()
+		jm.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Body.String() != want {
+			t.Fatalf("GET %s: got %q, want %q", target, rec.Body.String(), want)
+		}
+	}
+}
+
+func TestPatternConflict(t *testing.T) {
+
+	cases := [][2]string{
+		{"/posts/:id", "/posts/{name}"},
+		{"/{a}/x", "/x/{b}"},
+		{"/static/", "/static/*path"},
+	}
+	for _, cs := range cases {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("%q and %q should conflict", cs[0], cs[1])
+				}
+			}()
+			jm := New()
+			jm.GET(cs[0], "", func(c Context) error { return nil })
+			jm.GET(cs[1], "", func(c Context) error { return nil })
+		}()
+	}
+
+	jm := New()
+	jm.GET("/posts/:id", "", func(c Context) error { return nil })
+	jm.DELETE("/posts/:pid", "", func(c Context) error { return nil })
+}
+
+func TestConstraints(t *testing.T) {
+
+	jm := New()
+	jm.RegisterConstraint("even", func(s string) (interface{}, bool) {
+		i, err := strconv.Atoi(s)
+		return i, err == nil && i%2 == 0
+	})
+	name := func(n string) HandlerFunc {
+		return func(c Context) error { return c.String(http.StatusOK, n) }
+	}
+	jm.GET("/users/{id:int}", "user", name("int"))
+	jm.GET("/users/{name}", "user-name", name("name"))
+	jm.GET("/items/{id:uuid}", "item", name("uuid"))
+	jm.GET("/codes/{code:[a-z]{3}}", "code", name("regexp"))
+	jm.GET("/even/{n:even}", "even", name("even"))
+
+	cases := []struct {
+		target string
+		code   int
+		body   string
+	}{
+		{"/users/12", 200, "int"},
+		{"/users/bob", 200, "name"},
+		{"/items/0b9e4c52-6f6e-4d0a-8d47-2b2c1f0e9a11", 200, "uuid"},
+		{"/items/12", 404, ""},
+		{"/codes/abc", 200, "regexp"},
+		{"/codes/abcd", 404, ""},
+		{"/even/4", 200, "even"},
+		{"/even/3", 404, ""},
+	}
+	for _, cs := range cases {
+		rec := httptest.NewRecorder()
+		jm.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, cs.target, nil))
+		if rec.Code != cs.code || (cs.body != "" && rec.Body.String() != cs.body) {
+			t.Fatalf("GET %s: %d %q", cs.target, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestHost(t *testing.T) {
+
+	jm := New()
+	jm.GET("/health", "health", func(c Context) error { return c.String(http.StatusOK, "health") })
+
+	api := jm.Host("api.example.com")
+	api.GET("/users", "api-users", func(c Context) error { return c.String(http.StatusOK, "api") })
+	api.SetNotFoundHandler(func(c Context) error { return c.String(http.StatusNotFound, "api not found") })
+	api.GET("/items/{id:int}", "api-item", func(c Context) error { return c.String(http.StatusOK, "api item") })
+	jm.GET("/items/{name}", "item", func(c Context) error { return c.String(http.StatusOK, "item") })
+
+	tenant := jm.Host("{tenant}.example.com")
+	tenant.GET("/users", "tenant-users", func(c Context) error {
+		return c.String(http.StatusOK, c.ParamValue("tenant"))
+	})
+	tenant.GET("/billing", "tenant-billing", func(c Context) error {
+		return c.String(http.StatusOK, "billing "+c.ParamValue("tenant"))
+	})
+
+	cases := []struct {
+		host, target string
+		code         int
+		body         string
+	}{
+		{"api.example.com", "/users", 200, "api"},
+		{"API.example.com:8080", "/users", 200, "api"},
+		{"acme.example.com", "/users", 200, "acme"},
+		{"api.example.com", "/health", 200, "health"},
+		{"api.example.com", "/billing", 200, "billing api"},
+		{"api.example.com", "/nope", 404, "api not found"},
+		{"api.example.com", "/items/1", 200, "api item"},
+		{"api.example.com", "/items/bob", 200, "item"},
+		{"example.com", "/users", 404, "not found"},
+	}
+	for _, cs := range cases {
+		req := httptest.NewRequest(http.MethodGet, cs.target, nil)
+		req.Host = cs.host
+		rec := httptest.NewRecorder()
+		jm.ServeHTTP(rec, req)
+		if rec.Code != cs.code || rec.Body.String() != cs.body {
+			t.Fatalf("GET %s%s: %d %q", cs.host, cs.target, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestAnyMatchAutoHead(t *testing.T) {
+
+	jm := New()
+	jm.AutoHead(true)
+	h := func(c Context) error { return c.String(http.StatusOK, c.Request().Method) }
+	jm.Any("/any", "any", h)
+	jm.Group("/g").Match([]string{http.MethodGet, http.MethodPut}, "/match", "match", h)
+
+	for _, method := range []string{http.MethodPost, http.MethodTrace} {
+		rec := httptest.NewRecorder()
+		jm.ServeHTTP(rec, httptest.NewRequest(method, "/any", nil))
+		if rec.Body.String() != method {
+			t.Fatal("Any:", method, rec.Body.String())
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	jm.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/g/match", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get(HeaderAllow) != "GET, PUT, HEAD" {
+		t.Fatal("Match:", rec.Code, rec.Header())
+	}
+
+	rec = httptest.NewRecorder()
+	jm.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/g/match", nil))
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 || rec.Header().Get(HeaderContentLength) != "4" {
+		t.Fatal("AutoHead:", rec.Code, rec.Body.String(), rec.Header())
+	}
+}
+
+// TestSetHandlersServing sets the handlers of the mux while serving,
+// for the race detector.
+func TestSetHandlersServing(t *testing.T) {
+
+	jm := New()
+	jm.GET("/get", "get", func(c Context) error { return errors.New("boom") })
+	jm.Version("1").GET("/v", "v1", func(c Context) error { return nil })
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			for _, target := range []string{"/get", "/nope", "/v?v=2"} {
+				jm.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+			}
+			jm.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/get", nil))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		jm.SetNotFoundHandler(DefaultNotFoundHandler)
+		jm.SetHTTPErrorHandler(DefaultHttpErrorHandler)
+		jm.SetMethodNotAllowedHandler(DefaultMethodNotAllowedHandler)
+		jm.SetNotAcceptableHandler(DefaultNotAcceptableHandler)
+		jm.SetVersioning(Versioning{Selectors: []VersionSelector{QueryVersion("v")}})
+	}
+	<-done
+}
+
+func TestRuntimeRoutes(t *testing.T) {
+
+	jm := New()
+	jm.GET("/a", "a", func(c Context) error { return c.String(http.StatusOK, "a") })
+	jm.GET("/b", "b", func(c Context) error { return c.String(http.StatusOK, "b") })
+	jm.GET("/unnamed", "", func(c Context) error { return c.String(http.StatusOK, "unnamed") })
+
+	get := func(target string) string {
+		rec := httptest.NewRecorder()
+		jm.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return strconv.Itoa(rec.Code) + " " + rec.Body.String()
+	}
+
+	if err := jm.RemoveRoute("a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := get("/a"); got != "404 not found" {
+		t.Fatal("RemoveRoute:", got)
+	}
+	if err := jm.RemoveRoute("a"); err == nil {
+		t.Fatal("RemoveRoute: removed twice")
+	}
+	if err := jm.RemoveRoute(""); err == nil || get("/unnamed") != "200 unnamed" {
+		t.Fatal("RemoveRoute: removed the unnamed routes", err)
+	}
+
+	if err := jm.ReplaceRoute("b", func(c Context) error { return c.String(http.StatusOK, "b2") }); err != nil {
+		t.Fatal(err)
+	}
+	if got := get("/b"); got != "200 b2" {
+		t.Fatal("ReplaceRoute:", got)
+	}
+
+	err := jm.ReloadRoutes(func(jm *Jvmao) {
+		jm.GET("/c", "c", func(c Context) error { return c.String(http.StatusOK, "c") })
+		jm.GET("/c", "c2", func(c Context) error { return nil })
+	})
+	if err == nil || get("/b") != "200 b2" {
+		t.Fatal("ReloadRoutes: bad routes swapped in", err)
+	}
+
+	err = jm.ReloadRoutes(func(jm *Jvmao) {
+		jm.GET("/c", "c", func(c Context) error { return c.String(http.StatusOK, "c") })
+	})
+	if err != nil || get("/b") != "404 not found" || get("/c") != "200 c" {
+		t.Fatal("ReloadRoutes:", err)
+	}
+	if routes := jm.Routes(); len(routes) != 1 || routes[0].Name != "c" {
+		t.Fatal("ReloadRoutes: routes", routes)
+	}
+}
+
+func TestPathPolicy(t *testing.T) {
+
+	for name, newRouter := range routers {
+		jm := New()
+		jm.SetRouter(newRouter)
+		h := func(c Context) error { return c.String(http.StatusOK, c.ParamValue("id")) }
+		jm.GET("/users", "users", h)
+		jm.GET("/Users/{id}/Posts/", "posts", h)
+		api := jm.Group("//api/").Group("v1//")
+		api.GET("//items", "items", h)
+		jm.POST("/users", "create-user", h)
+
+		do := func(target string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			jm.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+			return rec
+		}
+
+		if r := jm.Routes(); r[2].Pattern != "/api/v1/items" || r[2].Prefix != "/api/v1" {
+			t.Fatal(name, "group prefix:", r[2])
+		}
+
+		// the default redirects the unclean paths and the trailing slash.
+		cases := map[string]string{
+			"/users/?a=1":      "/users?a=1",
+			"//api/./v1/items": "/api/v1/items",
+			"/Users/7/Posts":   "/Users/7/Posts/",
+		}
+		for target, want := range cases {
+			rec := do(target)
+			if rec.Code != http.StatusMovedPermanently || rec.Header().Get(HeaderLocation) != want {
+				t.Fatal(name, "redirect:", target, rec.Code, rec.Header())
+			}
+		}
+		rec := httptest.NewRecorder()
+		jm.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users/", nil))
+		if rec.Code != http.StatusPermanentRedirect || rec.Header().Get(HeaderLocation) != "/users" {
+			t.Fatal(name, "redirect POST:", rec.Code, rec.Header())
+		}
+		if rec := do("/USERS"); rec.Code != http.StatusNotFound {
+			t.Fatal(name, "case sensitive:", rec.Code)
+		}
+
+		jm.SetPathPolicy(PathPolicy{Mode: PathRedirect, RedirectCode: http.StatusPermanentRedirect, TrailingSlash: true, CaseInsensitive: true})
+		if rec := do("/users/AB/posts"); rec.Code != http.StatusPermanentRedirect || rec.Header().Get(HeaderLocation) != "/Users/AB/Posts/" {
+			t.Fatal(name, "case redirect:", rec.Code, rec.Header())
+		}
+		if rec := do("//users"); rec.Code != http.StatusNotFound {
+			t.Fatal(name, "unclean path:", rec.Code)
+		}
+
+		jm.SetPathPolicy(PathPolicy{Mode: PathTolerant, CleanPath: true, TrailingSlash: true, CaseInsensitive: true})
+		if rec := do("/users/AB/posts"); rec.Code != http.StatusOK || rec.Body.String() != "AB" {
+			t.Fatal(name, "tolerant:", rec.Code, rec.Body)
+		}
+		if rec := do("/api//v1/items/"); rec.Code != http.StatusOK {
+			t.Fatal(name, "tolerant:", rec.Code)
+		}
+
+		jm.SetPathPolicy(PathPolicy{})
+		for _, target := range []string{"/users/", "/Users/7/Posts", "/api//v1/items"} {
+			if rec := do(target); rec.Code != http.StatusNotFound {
+				t.Fatal(name, "strict:", target, rec.Code)
+			}
+		}
+
+		// the paths ServeMux would redirect are served by a catch-all.
+		jm.GET("/", "index", func(c Context) error { return c.String(http.StatusOK, "index") })
+		jm.GET("/static/", "static", h)
+		for _, target := range []string{"/static", "/a//b", "/users/"} {
+			if rec := do(target); rec.Code != http.StatusOK || rec.Body.String() != "index" {
+				t.Fatal(name, "catch-all:", target, rec.Code, rec.Body)
+			}
+		}
+	}
+}
+
+func TestGroupHandlers(t *testing.T) {
+
+	jm := New()
+	fail := func(c Context) error { return errors.New("boom") }
+	jm.GET("/fail", "fail", fail)
+
+	api := jm.Group("/api")
+	api.SetNotFoundHandler(func(c Context) error { return c.String(http.StatusNotFound, "api not found") })
+	api.GET("/items/{id:int}", "api-item", func(c Context) error { return c.String(http.StatusOK, "api item") })
+	jm.GET("/items/{name}", "item", func(c Context) error { return c.String(http.StatusOK, "item") })
+	api.SetHTTPErrorHandler(func(err error, c Context) { c.String(http.StatusTeapot, "api "+err.Error()) })
+	v1 := api.Group("/v1")
+	v1.GET("/fail", "v1-fail", fail)
+	admin := api.Group("/admin")
+	admin.SetNotFoundHandler(func(c Context) error { return fail(c) })
+	admin.SetHTTPErrorHandler(func(err error, c Context) { c.String(http.StatusBadGateway, "admin "+err.Error()) })
+
+	cases := []struct {
+		target string
+		code   int
+		body   string
+	}{
+		{"/nope", http.StatusNotFound, ""},
+		{"/fail", http.StatusInternalServerError, ""},
+		{"/apix", http.StatusNotFound, ""},
+		{"/api/nope", http.StatusNotFound, "api not found"},
+		{"/api/v1/nope", http.StatusNotFound, "api not found"},
+		{"/api/v1/fail", http.StatusTeapot, "api boom"},
+		{"/api/admin/nope", http.StatusBadGateway, "admin boom"},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		jm.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.target, nil))
+		if rec.Code != tc.code || (tc.body != "" && rec.Body.String() != tc.body) {
+			t.Fatal(tc.target, rec.Code, rec.Body)
+		}
+	}
+
+	// the method not allowed is sent by the group of the route.
+	rec := httptest.NewRecorder()
+	jm.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/fail", nil))
+	if rec.Code != http.StatusTeapot || rec.Body.String() != "api code=405, message=method not allowed" {
+		t.Fatal("method not allowed:", rec.Code, rec.Body)
+	}
+}
+
+func TestVersioning(t *testing.T) {
+
+	jm := New()
+	jm.SetVersioning(Versioning{
+		Selectors: []VersionSelector{HeaderVersion("X-API-Version"), AcceptVersion(), QueryVersion("v")},
+		Default:   "1",
+	})
+	text := func(s string) HandlerFunc {
+		return func(c Context) error { return c.String(http.StatusOK, s+c.ParamValue("id")) }
+	}
+	v1 := jm.Version("1")
+	v1.GET("/users/{id}", "user-v1", text("v1 "))
+	v2 := jm.Version("2").Group("/users")
+	v2.GET("/{id}", "user-v2", text("v2 "))
+	v2.GET("/{id:int}", "user-v2-int", text("v2 int "))
+	jm.GET("/health", "health", text("ok"))
+
+	cases := []struct {
+		target string
+		header http.Header
+		code   int
+		body   string
+	}{
+		{"/users/a", nil, http.StatusOK, "v1 a"},
+		{"/users/a?v=2", nil, http.StatusOK, "v2 a"},
+		{"/users/7", http.Header{"X-Api-Version": {"2"}}, http.StatusOK, "v2 int 7"},
+		{"/users/a", http.Header{"Accept": {"application/vnd.acme.v2+json"}}, http.StatusOK, "v2 a"},
+		{"/users/a", http.Header{"Accept": {"text/html, application/json; version=1"}}, http.StatusOK, "v1 a"},
+		{"/users/a", http.Header{"X-Api-Version": {"3"}}, http.StatusNotAcceptable, "code=406, message=not acceptable"},
+		{"/health", http.Header{"X-Api-Version": {"3"}}, http.StatusOK, "ok"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+		for k, v := range tc.header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		jm.ServeHTTP(rec, req)
+		if rec.Code != tc.code || rec.Body.String() != tc.body {
+			t.Fatal(tc.target, tc.header, rec.Code, rec.Body)
+		}
+	}
+
+	// the not acceptable is sent by the group of the route.
+	v1.SetHTTPErrorHandler(DefaultHttpJsonErrorHandler)
+	req := httptest.NewRequest(http.MethodGet, "/users/a", nil)
+	req.Header.Set("X-Api-Version", "3")
+	rec := httptest.NewRecorder()
+	jm.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotAcceptable || rec.Header().Get(HeaderContentType) != MIMEApplicationJSONUTF8 {
+		t.Fatal("not acceptable:", rec.Code, rec.Header(), rec.Body)
+	}
+
+	for name, f := range map[string]func(){
+		"the same version registered twice": func() { jm.Version("2").GET("/users/{name}", "dup", text("")) },
+		"not found handler of a version":    func() { v2.SetNotFoundHandler(text("v2 not found")) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal(name)
+				}
+			}()
+			f()
+		}()
+	}
+}
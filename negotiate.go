@@ -0,0 +1,239 @@
+package jvmao
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// Encoder encodes the data of Context.Negotiate.
+type Encoder interface {
+	Encode(w io.Writer, v any) error
+}
+
+// EncoderFunc is an Encoder of a function.
+type EncoderFunc func(w io.Writer, v any) error
+
+// Encode calls f(w, v).
+func (f EncoderFunc) Encode(w io.Writer, v any) error {
+	return f(w, v)
+}
+
+// ErrUnsupportedValue is returned by an Encoder that can't encode the
+// value, Context.Negotiate tries the next acceptable encoder.
+var ErrUnsupportedValue = errors.New("jvmao: value not supported by the encoder")
+
+// The encoders registered by New after the JSON of the Serializer,
+// by order of preference.
+var (
+	XMLEncoder EncoderFunc = func(w io.Writer, v any) error {
+		b, err := xml.Marshal(v)
+		var ute *xml.UnsupportedTypeError
+		if errors.As(err, &ute) {
+			return fmt.Errorf("%w: %v", ErrUnsupportedValue, err)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append([]byte(xml.Header), b...))
+		return err
+	}
+
+	YAMLEncoder EncoderFunc = func(w io.Writer, v any) error {
+		enc := yaml.NewEncoder(w)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+
+	MsgPackEncoder EncoderFunc = func(w io.Writer, v any) error {
+		return msgpack.NewEncoder(w).Encode(v)
+	}
+
+	CBOREncoder EncoderFunc = func(w io.Writer, v any) error {
+		return cbor.NewEncoder(w).Encode(v)
+	}
+
+	// ProtobufEncoder encodes a proto.Message only.
+	ProtobufEncoder EncoderFunc = func(w io.Writer, v any) error {
+		m, ok := v.(proto.Message)
+		if !ok {
+			return fmt.Errorf("%w: %T is not a proto.Message", ErrUnsupportedValue, v)
+		}
+		b, err := proto.Marshal(m)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+)
+
+type encoder struct {
+	contentType string
+	// mediaType is contentType without the parameters.
+	mediaType string
+	enc       Encoder
+}
+
+func defaultEncoders(jm *Jvmao) []encoder {
+	json := EncoderFunc(func(w io.Writer, v any) error {
+		return jm.Serializer().Serialize(w, v, jm.jsonIndent())
+	})
+	encs := []encoder{
+		{contentType: MIMEApplicationJSONUTF8, enc: json},
+		{contentType: MIMEApplicationXMLUTF8, enc: XMLEncoder},
+		{contentType: MIMEApplicationYAML, enc: YAMLEncoder},
+		{contentType: MIMEApplicationMsgPack, enc: MsgPackEncoder},
+		{contentType: MIMEApplicationCBOR, enc: CBOREncoder},
+		{contentType: MIMEApplicationProtobuf, enc: ProtobufEncoder},
+	}
+	for i := range encs {
+		encs[i].mediaType, _, _ = mime.ParseMediaType(encs[i].contentType)
+	}
+	return encs
+}
+
+// RegisterEncoder registers e for the content type of Context.Negotiate,
+// as "application/vnd.acme+json" or "text/csv; charset=utf-8". it
+// replaces the encoder of the same media type, a nil e removes it.
+// a new encoder is preferred after the registered ones.
+func (jm *Jvmao) RegisterEncoder(contentType string, e Encoder) {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil || strings.Contains(mt, "*") {
+		panic(fmt.Errorf("jvmao: invalid content type %q of encoder", contentType))
+	}
+	for {
+		old := jm.encoders.Load()
+		encs := slices.Clone(*old)
+		i := slices.IndexFunc(encs, func(x encoder) bool { return x.mediaType == mt })
+		switch {
+		case i >= 0 && e == nil:
+			encs = slices.Delete(encs, i, i+1)
+		case i >= 0:
+			encs[i] = encoder{contentType, mt, e}
+		case e != nil:
+			encs = append(encs, encoder{contentType, mt, e})
+		}
+		if jm.encoders.CompareAndSwap(old, &encs) {
+			return
+		}
+	}
+}
+
+func (c *context) Negotiate(statusCode int, data any) error {
+	c.w.Header().Add(HeaderVary, HeaderAccept)
+	var buf bytes.Buffer
+	for _, e := range acceptable(*c.jm.encoders.Load(), c.r.Header.Values(HeaderAccept)) {
+		buf.Reset()
+		err := e.enc.Encode(&buf, data)
+		if errors.Is(err, ErrUnsupportedValue) {
+			continue
+		}
+		if err != nil {
+			return c.Error(500, err)
+		}
+		return c.Blob(statusCode, e.contentType, buf.Bytes())
+	}
+	c.mux.mu.RLock()
+	h := c.mux.notAcceptableHandler
+	c.mux.mu.RUnlock()
+	return h(c)
+}
+
+// mediaRange is a media range of the Accept header.
+type mediaRange struct {
+	typ, sub string
+	q        float64
+}
+
+// parseAccept returns the media ranges of the Accept header values,
+// the invalid ones are dropped.
+func parseAccept(values []string) []mediaRange {
+	var ranges []mediaRange
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			params := strings.Split(s, ";")
+			typ, sub, ok := strings.Cut(strings.ToLower(strings.TrimSpace(params[0])), "/")
+			if !ok || typ == "" || sub == "" || (typ == "*" && sub != "*") {
+				continue
+			}
+			mr := mediaRange{typ: typ, sub: sub, q: 1}
+			for _, p := range params[1:] {
+				k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+				if strings.EqualFold(k, "q") {
+					q, err := strconv.ParseFloat(v, 64)
+					if err != nil || q < 0 || q > 1 {
+						ok = false
+					}
+					mr.q = q
+				}
+			}
+			if ok {
+				ranges = append(ranges, mr)
+			}
+		}
+	}
+	return ranges
+}
+
+// quality returns the quality of the media type mt in ranges, given by
+// the most specific range matching it.
+func quality(ranges []mediaRange, mt string) float64 {
+	typ, sub, _ := strings.Cut(mt, "/")
+	q, specificity := 0.0, 0
+	for _, r := range ranges {
+		s := 0
+		switch {
+		case r.typ == typ && r.sub == sub:
+			s = 3
+		case r.typ == typ && r.sub == "*":
+			s = 2
+		case r.typ == "*":
+			s = 1
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q
+}
+
+// acceptable returns the encoders accepted by the Accept header values,
+// by quality then order of preference. all are accepted without Accept.
+func acceptable(encs []encoder, accept []string) []encoder {
+	if strings.TrimSpace(strings.Join(accept, "")) == "" {
+		return encs
+	}
+	ranges := parseAccept(accept)
+	qs := make(map[string]float64, len(encs))
+	var res []encoder
+	for _, e := range encs {
+		if q := quality(ranges, e.mediaType); q > 0 {
+			qs[e.mediaType] = q
+			res = append(res, e)
+		}
+	}
+	slices.SortStableFunc(res, func(a, b encoder) int {
+		switch qa, qb := qs[a.mediaType], qs[b.mediaType]; {
+		case qa > qb:
+			return -1
+		case qa < qb:
+			return 1
+		}
+		return 0
+	})
+	return res
+}
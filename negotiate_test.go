@@ -0,0 +1,106 @@
+package jvmao
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"gopkg.in/yaml.v3"
+)
+
+type negotiateUser struct {
+	XMLName xml.Name `json:"-" yaml:"-" msgpack:"-" cbor:"-" xml:"user"`
+	Name    string   `json:"name" yaml:"name" msgpack:"name" cbor:"name" xml:"name"`
+}
+
+func TestNegotiate(t *testing.T) {
+
+	jm := New()
+	jm.RegisterEncoder("text/csv; charset=utf-8", EncoderFunc(func(w io.Writer, v any) error {
+		_, err := io.WriteString(w, "name\n"+v.(negotiateUser).Name+"\n")
+		return err
+	}))
+	jm.RegisterEncoder(MIMEApplicationCBOR, nil)
+	jm.GET("/user", "user", func(c Context) error {
+		return c.Negotiate(http.StatusOK, negotiateUser{Name: "jv"})
+	})
+	jm.GET("/proto", "proto", func(c Context) error {
+		return c.Negotiate(http.StatusOK, wrapperspb.String("jv"))
+	})
+
+	get := func(target, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if accept != "" {
+			req.Header.Set(HeaderAccept, accept)
+		}
+		rec := httptest.NewRecorder()
+		jm.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var u negotiateUser
+	decoders := map[string]func([]byte) error{
+		MIMEApplicationJSONUTF8: func(b []byte) error { return json.Unmarshal(b, &u) },
+		MIMEApplicationXMLUTF8:  func(b []byte) error { return xml.Unmarshal(b, &u) },
+		MIMEApplicationYAML:     func(b []byte) error { return yaml.Unmarshal(b, &u) },
+		MIMEApplicationMsgPack:  func(b []byte) error { return msgpack.Unmarshal(b, &u) },
+		"text/csv; charset=utf-8": func(b []byte) error {
+			u.Name = strings.TrimPrefix(strings.TrimSpace(string(b)), "name\n")
+			return nil
+		},
+	}
+	for accept, want := range map[string]string{
+		"":                                  MIMEApplicationJSONUTF8,
+		"*/*":                               MIMEApplicationJSONUTF8,
+		"application/xml, application/json": MIMEApplicationJSONUTF8,
+		"application/json;q=0.5, application/xml":                MIMEApplicationXMLUTF8,
+		"application/*;q=0.2, application/yaml;q=0.9, */*;q=0.1": MIMEApplicationYAML,
+		"application/msgpack, application/json;q=0":              MIMEApplicationMsgPack,
+		"text/*, application/*;q=0.5":                            "text/csv; charset=utf-8",
+		"application/json;q=0, */*":                              MIMEApplicationXMLUTF8,
+	} {
+		rec := get("/user", accept)
+		ct := rec.Header().Get(HeaderContentType)
+		if rec.Code != http.StatusOK || ct != want || rec.Header().Get(HeaderVary) != HeaderAccept {
+			t.Fatalf("%q: %d %q", accept, rec.Code, ct)
+		}
+		u = negotiateUser{}
+		if err := decoders[ct](rec.Body.Bytes()); err != nil || u.Name != "jv" {
+			t.Fatalf("%q: %v %q", accept, err, rec.Body)
+		}
+	}
+
+	// removed, unknown and invalid types are not acceptable.
+	for _, accept := range []string{"application/cbor", "image/png", "application/json;q=x"} {
+		if rec := get("/user", accept); rec.Code != http.StatusNotAcceptable {
+			t.Fatalf("%q: %d", accept, rec.Code)
+		}
+	}
+
+	// only a proto.Message is sent as protobuf.
+	if rec := get("/user", "application/x-protobuf"); rec.Code != http.StatusNotAcceptable {
+		t.Fatal("protobuf of a struct:", rec.Code)
+	}
+	rec := get("/proto", "application/x-protobuf, application/json;q=0.9")
+	var m wrapperspb.StringValue
+	if err := proto.Unmarshal(rec.Body.Bytes(), &m); err != nil || m.Value != "jv" ||
+		rec.Header().Get(HeaderContentType) != MIMEApplicationProtobuf {
+		t.Fatal("protobuf:", err, rec.Header())
+	}
+
+	jm.RegisterEncoder(MIMEApplicationCBOR, CBOREncoder)
+	rec = get("/user", "application/cbor")
+	u = negotiateUser{}
+	if err := cbor.NewDecoder(bytes.NewReader(rec.Body.Bytes())).Decode(&u); err != nil || u.Name != "jv" {
+		t.Fatal("cbor:", err, rec.Header())
+	}
+}
@@ -0,0 +1,302 @@
+package jvmao
+
+import (
+	"fmt"
+	"go/token"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// segment is a piece of a route pattern between slashes.
+type segment struct {
+	s     string // literal, or the param name of a wildcard
+	wild  bool
+	multi bool // matches the rest of the path
+	end   bool // "{$}", matches the trailing slash only
+
+	// cons is the constraint of a wildcard such as "int" in "{id:int}".
+	cons  string
+	check Constraint
+}
+
+// routePattern is the parsed form of a route pattern. it accepts the
+// ServeMux syntax "{id}", "{path...}" and "{$}" along with ":id" and "*path".
+// a pattern ending in a slash matches any path with the prefix.
+// "{id:name}" constrains the param with the named Constraint or a
+// regular expression.
+type routePattern struct {
+	raw  string
+	segs []segment
+}
+
+// parsePattern parses raw, lookup resolves the constraints of the params.
+func parsePattern(raw string, lookup func(name string) (Constraint, error)) (*routePattern, error) {
+	if !strings.HasPrefix(raw, "/") {
+		return nil, fmt.Errorf("jvmao: bad pattern %q: must start with /", raw)
+	}
+	p := &routePattern{raw: raw}
+	names := map[string]bool{}
+	parts := strings.Split(raw[1:], "/")
+	for i, part := range parts {
+		last := i == len(parts)-1
+		var seg segment
+		switch {
+		case part == "" && last:
+			if i > 0 || raw == "/" {
+				seg = segment{wild: true, multi: true}
+			}
+		case part == "":
+			return nil, fmt.Errorf("jvmao: bad pattern %q: empty segment", raw)
+		case part == "{$}":
+			seg = segment{s: "/", end: true}
+		case part[0] == ':':
+			seg = segment{s: part[1:], wild: true}
+		case part[0] == '*':
+			seg = segment{s: part[1:], wild: true, multi: true}
+			if seg.s == "" {
+				seg.s = "*"
+			}
+		case part[0] == '{' && part[len(part)-1] == '}':
+			name := part[1 : len(part)-1]
+			seg = segment{wild: true}
+			if i := strings.IndexByte(name, ':'); i >= 0 {
+				c, err := lookup(name[i+1:])
+				if err != nil {
+					return nil, err
+				}
+				name, seg.cons, seg.check = name[:i], name[i+1:], c
+			} else if strings.HasSuffix(name, "...") {
+				name, seg.multi = strings.TrimSuffix(name, "..."), true
+			}
+			seg.s = name
+		case strings.ContainsAny(part, "{}"):
+			return nil, fmt.Errorf("jvmao: bad pattern %q: bad wildcard segment %q", raw, part)
+		default:
+			seg = segment{s: part}
+		}
+		if seg.s == "" && !seg.multi {
+			if seg.wild {
+				return nil, fmt.Errorf("jvmao: bad pattern %q: empty param name", raw)
+			}
+			continue
+		}
+		if (seg.multi || seg.end) && !last {
+			return nil, fmt.Errorf("jvmao: bad pattern %q: %q must be the last segment", raw, part)
+		}
+		if seg.wild && seg.s != "" {
+			if seg.s != "*" && !token.IsIdentifier(seg.s) {
+				return nil, fmt.Errorf("jvmao: bad pattern %q: bad param name %q", raw, seg.s)
+			}
+			if names[seg.s] {
+				return nil, fmt.Errorf("jvmao: bad pattern %q: duplicate param name %q", raw, seg.s)
+			}
+			names[seg.s] = true
+		}
+		p.segs = append(p.segs, seg)
+	}
+	return p, nil
+}
+
+// muxPattern returns the pattern for http.ServeMux, params are renamed
+// by position so patterns with the same shape share one entry.
+func (p *routePattern) muxPattern() string {
+	var b strings.Builder
+	n := 0
+	for _, seg := range p.segs {
+		b.WriteByte('/')
+		switch {
+		case seg.end:
+			b.WriteString("{$}")
+		case seg.wild:
+			b.WriteString("{p" + strconv.Itoa(n))
+			if seg.multi {
+				b.WriteString("...")
+			}
+			b.WriteByte('}')
+			n++
+		default:
+			b.WriteString(seg.s)
+		}
+	}
+	if b.Len() == 0 {
+		return "/"
+	}
+	return b.String()
+}
+
+// path returns the escaped path matched by p with the values of
+// the params.
+func (p *routePattern) path(values []string) string {
+	var b strings.Builder
+	i := 0
+	for _, seg := range p.segs {
+		b.WriteByte('/')
+		switch {
+		case seg.end:
+		case seg.wild:
+			b.WriteString(escapeParam(values[i], seg.multi))
+			i++
+		default:
+			b.WriteString(seg.s)
+		}
+	}
+	if b.Len() == 0 {
+		return "/"
+	}
+	return b.String()
+}
+
+// constraints returns the constraints of the params joined,
+// routes on the same pattern must differ in it.
+func (p *routePattern) constraints() string {
+	var b strings.Builder
+	for _, seg := range p.segs {
+		if seg.wild {
+			b.WriteString(seg.cons)
+			b.WriteByte('/')
+		}
+	}
+	return b.String()
+}
+
+// constrained counts the params with a constraint.
+func (p *routePattern) constrained() int {
+	n := 0
+	for _, seg := range p.segs {
+		if seg.check != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// params returns the param names in order.
+func (p *routePattern) params() []string {
+	var names []string
+	for _, seg := range p.segs {
+		if seg.wild {
+			names = append(names, seg.s)
+		}
+	}
+	return names
+}
+
+// values appends the values of the params in the escaped path
+// matched by p.
+func (p *routePattern) values(path string, values []string) []string {
+	path = strings.TrimPrefix(path, "/")
+	for _, seg := range p.segs {
+		if seg.multi {
+			values = append(values, unescape(path))
+			break
+		}
+		var s string
+		s, path, _ = strings.Cut(path, "/")
+		if seg.wild {
+			values = append(values, unescape(s))
+		}
+	}
+	return values
+}
+
+// matches reports whether p matches the escaped path.
+func (p *routePattern) matches(path string) bool {
+	rest, more := strings.TrimPrefix(path, "/"), true
+	for _, seg := range p.segs {
+		switch {
+		case !more:
+			return false
+		case seg.multi:
+			return true
+		case seg.end:
+			return rest == ""
+		}
+		var s string
+		s, rest, more = strings.Cut(rest, "/")
+		if (seg.wild && s == "") || (!seg.wild && unescape(s) != seg.s) {
+			return false
+		}
+	}
+	return !more
+}
+
+func unescape(s string) string {
+	if v, err := url.PathUnescape(s); err == nil {
+		return v
+	}
+	return s
+}
+
+type relationship int
+
+const (
+	equivalent relationship = iota
+	moreGeneral
+	moreSpecific
+	disjoint
+	overlaps
+)
+
+// conflicts reports whether p and q could match the same path with
+// neither of them being more specific, which http.ServeMux rejects.
+func (p *routePattern) conflicts(q *routePattern) bool {
+	rel := comparePaths(p.segs, q.segs)
+	return rel == equivalent || rel == overlaps
+}
+
+func comparePaths(a, b []segment) relationship {
+	rel := equivalent
+	for i := 0; ; i++ {
+		if i == len(a) || i == len(b) {
+			if len(a) == len(b) {
+				return rel
+			}
+			return disjoint
+		}
+		sa, sb := a[i], b[i]
+		switch {
+		case sa.multi && sb.multi:
+			return rel
+		case sa.multi:
+			return combineRelationships(rel, moreGeneral)
+		case sb.multi:
+			return combineRelationships(rel, moreSpecific)
+		}
+		if rel = combineRelationships(rel, compareSegments(sa, sb)); rel == disjoint {
+			return rel
+		}
+	}
+}
+
+func compareSegments(a, b segment) relationship {
+	switch {
+	case a.wild && b.wild:
+		return equivalent
+	case a.wild:
+		if b.end {
+			return disjoint
+		}
+		return moreGeneral
+	case b.wild:
+		if a.end {
+			return disjoint
+		}
+		return moreSpecific
+	case a.s == b.s:
+		return equivalent
+	}
+	return disjoint
+}
+
+func combineRelationships(r1, r2 relationship) relationship {
+	switch {
+	case r1 == disjoint || r2 == disjoint:
+		return disjoint
+	case r1 == equivalent:
+		return r2
+	case r2 == equivalent || r1 == r2:
+		return r1
+	}
+	return overlaps
+}
@@ -0,0 +1,136 @@
+package jvmao
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// PathMode is how a request path matching a route only after being
+// fixed by the PathPolicy is served.
+type PathMode int
+
+const (
+	// PathStrict serves the paths matching a route as they are,
+	// the others are not found.
+	PathStrict PathMode = iota
+	// PathRedirect redirects to the canonical path of the route.
+	PathRedirect
+	// PathTolerant serves the route without redirecting.
+	PathTolerant
+)
+
+// PathPolicy fixes the request paths matching no route.
+type PathPolicy struct {
+	Mode PathMode
+	// RedirectCode is the status of PathRedirect, http.StatusMovedPermanently
+	// by default. http.StatusPermanentRedirect keeps the method and body,
+	// the methods other than GET and HEAD get it for a 301, and
+	// http.StatusTemporaryRedirect for a 302.
+	RedirectCode int
+	// CleanPath removes the repeated slashes and the "." and ".." segments.
+	CleanPath bool
+	// TrailingSlash adds or removes the trailing slash, "/users/" finds
+	// "/users" and the other way round.
+	TrailingSlash bool
+	// CaseInsensitive matches the literal segments ignoring case, the
+	// canonical path is in the case of the pattern.
+	CaseInsensitive bool
+}
+
+// DefaultPathPolicy redirects the unclean paths and the paths differing
+// from a pattern in the trailing slash.
+var DefaultPathPolicy = PathPolicy{
+	Mode:          PathRedirect,
+	RedirectCode:  http.StatusMovedPermanently,
+	CleanPath:     true,
+	TrailingSlash: true,
+}
+
+// fix returns the entry matching the path fixed by the policy and the
+// canonical path, the values of the params are set in ctx.
+func (hm *hostMux) fix(ctx *context, p string) (string, *entry) {
+	policy := hm.policy
+	if policy.CleanPath {
+		p = cleanPath(p)
+	}
+	paths := []string{p}
+	if policy.TrailingSlash && p != "/" {
+		if strings.HasSuffix(p, "/") {
+			paths = append(paths, strings.TrimSuffix(p, "/"))
+		} else {
+			paths = append(paths, p+"/")
+		}
+	}
+	for _, p := range paths {
+		if e := hm.lookup(ctx, p); e != nil {
+			return p, e
+		}
+	}
+	if hm.fold == nil {
+		return "", nil
+	}
+	for _, p := range paths {
+		v, _ := hm.fold.Find(strings.ToLower(p), ctx.values[:0])
+		if e, ok := v.(*entry); ok {
+			ctx.values = e.pattern.values(p, ctx.values[:0])
+			return e.pattern.path(ctx.values), e
+		}
+	}
+	return "", nil
+}
+
+// redirectHandler redirects to the path keeping the query, and the
+// method with the body of a request other than GET and HEAD.
+func redirectHandler(code int, path string) HandlerFunc {
+	if code == 0 {
+		code = http.StatusMovedPermanently
+	}
+	return func(c Context) error {
+		r := c.Request()
+		url := path
+		if q := r.URL.RawQuery; q != "" {
+			url += "?" + q
+		}
+		code := code
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			switch code {
+			case http.StatusMovedPermanently:
+				code = http.StatusPermanentRedirect
+			case http.StatusFound:
+				code = http.StatusTemporaryRedirect
+			}
+		}
+		return c.Redirect(code, url)
+	}
+}
+
+// cleanPath returns the canonical path of p, the trailing slash is kept.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	np := path.Clean(p)
+	if p[len(p)-1] == '/' && np != "/" {
+		np += "/"
+	}
+	return np
+}
+
+// joinPath joins the prefix of a group and pattern, the repeated
+// slashes are collapsed.
+func joinPath(prefix, pattern string) string {
+	p := prefix + "/" + pattern
+	var b strings.Builder
+	b.Grow(len(p))
+	for i := 0; i < len(p); i++ {
+		if p[i] == '/' && i > 0 && p[i-1] == '/' {
+			continue
+		}
+		b.WriteByte(p[i])
+	}
+	return b.String()
+}
@@ -1,22 +1,188 @@
 package jvmao
 
 import (
+	"fmt"
+	"html/template"
 	"io"
-	"text/template"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	ttemplate "text/template"
 )
 
 type Renderer interface {
 	Render(w io.Writer, name string, data interface{}, c Context) error
 }
 
+// DefaultRenderer renders the template file named with text/template,
+// it parses the file on each render and doesn't escape HTML. use
+// TemplateRenderer for serving pages.
 type DefaultRenderer struct{}
 
 func (dr *DefaultRenderer) Render(w io.Writer, name string, data interface{}, c Context) error {
 
-	t, err := template.New(name).ParseFiles(name)
+	t, err := ttemplate.ParseFiles(name)
 	if err != nil {
 		return err
 	}
 	return t.Execute(w, data)
 
 }
+
+// CSRFKey is the key of the CSRF token a middleware sets in the Context,
+// csrfField of TemplateRenderer reads it.
+const CSRFKey = "csrf"
+
+// TemplateOptions configures a TemplateRenderer.
+type TemplateOptions struct {
+	// Layouts and Partials are the glob patterns of the templates parsed
+	// with each page, such as "layouts/*.html".
+	Layouts  []string
+	Partials []string
+	// Layout is the template executed for the pages, such as
+	// "layouts/base.html", the pages fill its blocks. "" executes the page.
+	Layout string
+	// Funcs are added to the built in funcs.
+	Funcs template.FuncMap
+	// AssetPrefix is prefixed to the paths of asset, "/static/" by default.
+	AssetPrefix string
+	// Assets maps the asset names to their paths, such as to the names
+	// with a content hash.
+	Assets map[string]string
+	// CSRFField is the name of the input of csrfField, "csrf_token"
+	// by default.
+	CSRFField string
+}
+
+// TemplateRenderer is a Renderer of html/template. the templates are
+// loaded from an fs.FS by their path, such as "pages/index.html", and
+// parsed once with the layouts and partials. they are parsed on each
+// render in debug mode.
+//
+// the built in funcs are:
+//
+//	reverse "name" params...  the path of the named route
+//	asset "css/app.css"       the path of an asset
+//	csrfField                 the hidden input of the CSRF token
+type TemplateRenderer struct {
+	fsys fs.FS
+	opts TemplateOptions
+
+	mu    sync.RWMutex
+	cache map[string]*template.Template
+}
+
+// NewTemplateRenderer returns a TemplateRenderer of the templates in fsys.
+func NewTemplateRenderer(fsys fs.FS, opts TemplateOptions) *TemplateRenderer {
+	if opts.AssetPrefix == "" {
+		opts.AssetPrefix = "/static/"
+	}
+	if opts.CSRFField == "" {
+		opts.CSRFField = "csrf_token"
+	}
+	return &TemplateRenderer{fsys: fsys, opts: opts, cache: map[string]*template.Template{}}
+}
+
+func (tr *TemplateRenderer) Render(w io.Writer, name string, data interface{}, c Context) error {
+	t, err := tr.lookup(name, c != nil && c.Debug())
+	if err != nil {
+		return err
+	}
+	// the cached set is never executed, the clones get the funcs of c.
+	if t, err = t.Clone(); err != nil {
+		return err
+	}
+	t.Funcs(tr.funcs(c))
+	entry := name
+	if tr.opts.Layout != "" {
+		entry = tr.opts.Layout
+	}
+	return t.ExecuteTemplate(w, entry, data)
+}
+
+// lookup returns the parsed set of the page, reload skips the cache.
+func (tr *TemplateRenderer) lookup(name string, reload bool) (*template.Template, error) {
+	if !reload {
+		tr.mu.RLock()
+		t, ok := tr.cache[name]
+		tr.mu.RUnlock()
+		if ok {
+			return t, nil
+		}
+	}
+	t, err := tr.parse(name)
+	if err != nil {
+		return nil, err
+	}
+	tr.mu.Lock()
+	tr.cache[name] = t
+	tr.mu.Unlock()
+	return t, nil
+}
+
+// parse parses the layouts, the partials then the page, so the blocks
+// of the page replace the ones of the layouts.
+func (tr *TemplateRenderer) parse(name string) (*template.Template, error) {
+	var files []string
+	for _, pattern := range append(append([]string(nil), tr.opts.Layouts...), tr.opts.Partials...) {
+		matches, err := fs.Glob(tr.fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+
+	t := template.New(name).Funcs(tr.funcs(nil))
+	for _, file := range files {
+		b, err := fs.ReadFile(tr.fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := t.New(file).Parse(string(b)); err != nil {
+			return nil, err
+		}
+	}
+	// the page is the root of the set.
+	b, err := fs.ReadFile(tr.fsys, path.Clean(name))
+	if err != nil {
+		return nil, err
+	}
+	return t.Parse(string(b))
+}
+
+// funcs returns the built in funcs for c, they are placeholders for
+// parsing when c is nil.
+func (tr *TemplateRenderer) funcs(c Context) template.FuncMap {
+	fm := template.FuncMap{}
+	for k, f := range tr.opts.Funcs {
+		fm[k] = f
+	}
+	fm["asset"] = tr.asset
+	fm["reverse"] = func(name string, params ...interface{}) (string, error) {
+		if c == nil {
+			return "", fmt.Errorf("jvmao: reverse %q: no context", name)
+		}
+		ps := make([]string, len(params))
+		for i, p := range params {
+			ps[i] = fmt.Sprint(p)
+		}
+		return c.Reverse(name, ps...)
+	}
+	fm["csrfField"] = func() template.HTML {
+		token := ""
+		if c != nil {
+			token, _ = c.Get(CSRFKey).(string)
+		}
+		return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`,
+			template.HTMLEscapeString(tr.opts.CSRFField), template.HTMLEscapeString(token)))
+	}
+	return fm
+}
+
+func (tr *TemplateRenderer) asset(name string) string {
+	if p, ok := tr.opts.Assets[name]; ok {
+		name = p
+	}
+	return tr.opts.AssetPrefix + strings.TrimPrefix(name, "/")
+}
@@ -0,0 +1,142 @@
+package jvmao
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+type testRenderer struct{}
+
+func (testRenderer) Render(w io.Writer, name string, data interface{}, c Context) error {
+	if name == "fail" {
+		_, _ = io.WriteString(w, "partial")
+		return errors.New("render failed")
+	}
+	_, err := fmt.Fprintf(w, "%s:%v:%v", name, data, c.Debug())
+	return err
+}
+
+func TestRender(t *testing.T) {
+
+	jm := New()
+	jm.SetRenderer(testRenderer{})
+	jm.OpenDebug()
+	var handled error
+	jm.SetHTTPErrorHandler(func(err error, c Context) {
+		handled = err
+		_ = c.String(http.StatusInternalServerError, "error page")
+	})
+	jm.GET("/{name}", "page", func(c Context) error {
+		return c.Render(http.StatusCreated, c.ParamValue("name"), 1)
+	})
+
+	rec := httptest.NewRecorder()
+	jm.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/index", nil))
+	if rec.Code != http.StatusCreated || rec.Body.String() != "index:1:true" ||
+		rec.Header().Get(HeaderContentType) != MIMETextHTMLUTF8 {
+		t.Fatal("render:", rec.Code, rec.Header(), rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	jm.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fail", nil))
+	if handled == nil || handled.Error() != "render failed" {
+		t.Fatal("render error not handled:", handled)
+	}
+	if rec.Code != http.StatusInternalServerError || rec.Body.String() != "error page" {
+		t.Fatal("render error:", rec.Code, rec.Body)
+	}
+}
+
+func TestDefaultRenderer(t *testing.T) {
+
+	name := filepath.Join(t.TempDir(), "hello.tmpl")
+	if err := os.WriteFile(name, []byte("hello {{.}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	jm := New()
+	jm.SetRenderer(nil)
+	jm.GET("/", "hello", func(c Context) error {
+		return c.Render(http.StatusOK, name, "jvmao")
+	})
+	jm.GET("/missing", "missing", func(c Context) error {
+		return c.Render(http.StatusOK, name+".missing", nil)
+	})
+
+	rec := httptest.NewRecorder()
+	jm.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello jvmao" {
+		t.Fatal("default renderer:", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	jm.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatal("missing template:", rec.Code, rec.Body)
+	}
+}
+
+func TestTemplateRenderer(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"layouts/base.html": {Data: []byte(`<title>{{block "title" .}}site{{end}}</title>{{template "content" .}}`)},
+		"partials/nav.html": {Data: []byte(`{{define "nav"}}<a href="{{reverse "user" 7}}">u</a>{{end}}`)},
+		"pages/user.html": {Data: []byte(`{{define "title"}}user{{end}}{{define "content"}}{{template "nav"}}` +
+			`<p>{{.}}</p><link href="{{asset "app.css"}}">{{csrfField}}{{end}}`)},
+		"pages/plain.html": {Data: []byte(`{{define "content"}}plain{{end}}`)},
+	}
+	tr := NewTemplateRenderer(fsys, TemplateOptions{
+		Layouts:  []string{"layouts/*.html"},
+		Partials: []string{"partials/*.html"},
+		Layout:   "layouts/base.html",
+		Assets:   map[string]string{"app.css": "app.123.css"},
+	})
+
+	jm := New()
+	jm.SetRenderer(tr)
+	jm.GET("/users/{id}", "user", func(c Context) error {
+		c.Set(CSRFKey, `t"1`)
+		return c.Render(http.StatusOK, "pages/user.html", "<b>")
+	})
+	jm.GET("/plain", "plain", func(c Context) error {
+		return c.Render(http.StatusOK, "pages/plain.html", nil)
+	})
+	jm.GET("/missing", "missing", func(c Context) error {
+		return c.Render(http.StatusOK, "pages/missing.html", nil)
+	})
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		jm.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	want := `<title>user</title><a href="/users/7">u</a><p>&lt;b&gt;</p>` +
+		`<link href="/static/app.123.css"><input type="hidden" name="csrf_token" value="t&#34;1">`
+	if rec := get("/users/1"); rec.Body.String() != want {
+		t.Fatal("template:", rec.Body)
+	}
+	if rec := get("/plain"); rec.Body.String() != "<title>site</title>plain" {
+		t.Fatal("default block:", rec.Body)
+	}
+	if rec := get("/missing"); rec.Code != http.StatusInternalServerError {
+		t.Fatal("missing template:", rec.Code)
+	}
+
+	// the cached set is served until debug mode reloads it.
+	fsys["pages/plain.html"] = &fstest.MapFile{Data: []byte(`{{define "content"}}changed{{end}}`)}
+	if rec := get("/plain"); rec.Body.String() != "<title>site</title>plain" {
+		t.Fatal("cache:", rec.Body)
+	}
+	jm.OpenDebug()
+	if rec := get("/plain"); rec.Body.String() != "<title>site</title>changed" {
+		t.Fatal("reload:", rec.Body)
+	}
+}
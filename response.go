@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"net"
 	"net/http"
+	"strconv"
 )
 
 func NewResponse(w http.ResponseWriter) *Response {
@@ -20,6 +21,11 @@ type Response struct {
 	Status      int
 	Size        int64
 	wroteHeader bool // reply header has been (logically) written
+
+	// head drops the body of a HEAD request served by a GET handler,
+	// the header is held until finish to send the Content-Length.
+	head     bool
+	headSent bool
 }
 
 // Header returns the header map that will be sent by
@@ -38,6 +44,10 @@ func (r *Response) Write(buf []byte) (n int, err error) {
 		}
 		r.WriteHeader(r.Status)
 	}
+	if r.head {
+		r.Size += int64(len(buf))
+		return len(buf), nil
+	}
 	n, err = r.writer.Write(buf)
 	r.Size += int64(n)
 	return
@@ -51,20 +61,60 @@ func (r *Response) WriteHeader(statusCode int) {
 		return
 	}
 	r.Status = statusCode
-	r.writer.WriteHeader(statusCode)
 	r.wroteHeader = true
+	if r.head {
+		return
+	}
+	r.writer.WriteHeader(statusCode)
 }
 
 // Flush sends any buffered data to the client.
 // more [http.Flusher](https://golang.org/pkg/net/http/#Flusher)
 func (r *Response) Flush() {
-	r.writer.(http.Flusher).Flush()
+	if r.head {
+		r.sendHead()
+	}
+	_ = http.NewResponseController(r.writer).Flush()
+}
+
+// Unwrap returns the wrapped http.ResponseWriter,
+// for http.ResponseController.
+func (r *Response) Unwrap() http.ResponseWriter {
+	return r.writer
 }
 
 // Hijack allow an HTTP handler to take over the connection.
 // more [http.Hijacker](https://golang.org/pkg/net/http/#Hijacker)
+// it returns http.ErrNotSupported when the writer can't be hijacked.
 func (r *Response) Hijack() (net.Conn, *bufio.ReadWriter, error) {
-	return r.writer.(http.Hijacker).Hijack()
+	return http.NewResponseController(r.writer).Hijack()
+}
+
+// finish sends the header held for a HEAD request, with the
+// Content-Length of the dropped body.
+func (r *Response) finish() {
+	if !r.head || r.headSent {
+		return
+	}
+	if !r.wroteHeader {
+		r.WriteHeader(r.Status)
+	}
+	if r.Header().Get(HeaderContentLength) == "" && r.Status >= http.StatusOK &&
+		r.Status != http.StatusNoContent && r.Status != http.StatusNotModified {
+		r.Header().Set(HeaderContentLength, strconv.FormatInt(r.Size, 10))
+	}
+	r.sendHead()
+}
+
+func (r *Response) sendHead() {
+	if r.headSent {
+		return
+	}
+	if !r.wroteHeader {
+		r.WriteHeader(r.Status)
+	}
+	r.headSent = true
+	r.writer.WriteHeader(r.Status)
 }
 
 func (r *Response) reset(w http.ResponseWriter) {
@@ -72,4 +122,6 @@ func (r *Response) reset(w http.ResponseWriter) {
 	r.Size = 0
 	r.Status = http.StatusOK
 	r.wroteHeader = false
+	r.head = false
+	r.headSent = false
 }
@@ -1,7 +1,89 @@
 package jvmao
 
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Route describes a registered route.
+type Route struct {
+	Method  string
+	Host    string
+	Pattern string
+	Name    string
+	// Prefix is the prefix of the group the route registered in.
+	Prefix string
+	// Version is the API version the route serves, "" serves any.
+	Version string
+	// Middleware counts the middleware wraps the handler when serving.
+	Middleware int
+
+	meta *RouteMeta
+}
+
+// Meta returns the metadata of the route set with key, nil when unset.
+func (r *Route) Meta(key string) interface{} {
+	if r.meta == nil {
+		return nil
+	}
+	return r.meta.values[key]
+}
+
+// Tags returns the tags of the route.
+func (r *Route) Tags() []string {
+	if r.meta == nil {
+		return nil
+	}
+	return r.meta.tags
+}
+
+// HasTag reports whether the route has tag.
+func (r *Route) HasTag(tag string) bool {
+	for _, t := range r.Tags() {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// RouteMeta is the metadata of the routes registered together, such
+// as the methods of Match. set it before serving, the middleware read it
+// with Context.Route.
+type RouteMeta struct {
+	values map[string]interface{}
+	tags   []string
+}
+
+// Set sets the metadata value with key, such as the scopes required or
+// an OpenAPI summary.
+func (m *RouteMeta) Set(key string, value interface{}) *RouteMeta {
+	if m.values == nil {
+		m.values = map[string]interface{}{}
+	}
+	m.values[key] = value
+	return m
+}
+
+// Tag adds tags to the routes.
+func (m *RouteMeta) Tag(tags ...string) *RouteMeta {
+	m.tags = append(m.tags, tags...)
+	return m
+}
+
 type routeChache struct {
+	mu     sync.RWMutex
 	chache map[string]string
+	routes []routeRecord
+}
+
+// routeRecord is a registered route of group served by chain.
+type routeRecord struct {
+	Route
+	group *Group
+	chain *chain
 }
 
 func newRouteChache() *routeChache {
@@ -9,5 +91,102 @@ func newRouteChache() *routeChache {
 }
 
 func (rc *routeChache) SetRoute(name, pattern string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
 	rc.chache[name] = pattern
 }
+
+func (rc *routeChache) AddRoute(r routeRecord) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.routes = append(rc.routes, r)
+	if r.Name != "" {
+		rc.chache[r.Name] = r.Pattern
+	}
+}
+
+func (rc *routeChache) records() []routeRecord {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	return append([]routeRecord(nil), rc.routes...)
+}
+
+// Routes returns a copy of the registered routes in registration order.
+func (rc *routeChache) Routes() []Route {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	routes := make([]Route, len(rc.routes))
+	for i, r := range rc.routes {
+		routes[i] = r.Route
+		routes[i].Middleware = len(r.chain.stack())
+	}
+	return routes
+}
+
+// Reverse builds the path of the named route, params fill in
+// the "{id}", "{path...}", ":id" and "*path" segments in order.
+func (rc *routeChache) Reverse(name string, params ...string) (string, error) {
+	rc.mu.RLock()
+	pattern, ok := rc.chache[name]
+	rc.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("jvmao: reverse: route %q not found", name)
+	}
+	return reversePattern(pattern, params...)
+}
+
+func reversePattern(pattern string, params ...string) (string, error) {
+	segs := strings.Split(pattern, "/")
+	n := 0
+	for i, seg := range segs {
+		key, multi, ok := paramSegment(seg)
+		if !ok {
+			continue
+		}
+		if key == "$" {
+			segs[i] = ""
+			continue
+		}
+		if n >= len(params) {
+			return "", fmt.Errorf("jvmao: reverse %q: missing param %q", pattern, key)
+		}
+		segs[i] = escapeParam(params[n], multi)
+		n++
+	}
+	if n < len(params) {
+		return "", fmt.Errorf("jvmao: reverse %q: %d extra params", pattern, len(params)-n)
+	}
+	return strings.Join(segs, "/"), nil
+}
+
+// paramSegment reports the param name of a pattern segment and
+// whether it matches the rest of the path.
+func paramSegment(seg string) (key string, multi bool, ok bool) {
+	switch {
+	case strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}"):
+		key = seg[1 : len(seg)-1]
+		if i := strings.IndexByte(key, ':'); i >= 0 {
+			key = key[:i]
+		}
+		if strings.HasSuffix(key, "...") {
+			key, multi = strings.TrimSuffix(key, "..."), true
+		}
+		return key, multi, true
+	case strings.HasPrefix(seg, ":"):
+		return seg[1:], false, true
+	case strings.HasPrefix(seg, "*"):
+		return seg[1:], true, true
+	}
+	return "", false, false
+}
+
+func escapeParam(v string, multi bool) string {
+	if !multi {
+		return url.PathEscape(v)
+	}
+	parts := strings.Split(v, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,236 @@
+package jvmao
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Router matches request paths against the patterns registered on it.
+// mux checks the patterns for conflicts before adding them, so a Router
+// only needs to find the most specific pattern matching a path.
+//
+// patterns are in the http.ServeMux syntax without method and host,
+// the wildcards are named by position, such as "/users/{p0}/files/{p1...}",
+// a pattern ending in "/{$}" matches the trailing slash only.
+type Router interface {
+	// Add registers v on pattern.
+	Add(pattern string, v interface{}) error
+
+	// Find returns the value registered on the pattern matching the
+	// escaped path, the unescaped values of the wildcards are appended
+	// to values. v is nil when no pattern matches, the path is matched
+	// as it is, PathPolicy fixes it.
+	Find(path string, values []string) (v interface{}, _ []string)
+}
+
+// NewServeMuxRouter returns a Router backed by http.ServeMux,
+// it is the default Router.
+func NewServeMuxRouter() Router {
+	return &serveMuxRouter{
+		serverMux: http.NewServeMux(),
+		patterns:  map[string]*muxValue{},
+	}
+}
+
+type serveMuxRouter struct {
+	serverMux *http.ServeMux
+	patterns  map[string]*muxValue
+}
+
+// muxValue is registered in http.ServeMux for looking v up.
+type muxValue struct {
+	v interface{}
+	p *routePattern
+}
+
+func (mv *muxValue) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	http.NotFound(w, r)
+}
+
+func (sr *serveMuxRouter) Add(pattern string, v interface{}) (err error) {
+	p, err := parsePattern(pattern, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rvr := recover(); rvr != nil {
+			err = fmt.Errorf("jvmao: %v", rvr)
+		}
+	}()
+	mv := &muxValue{v, p}
+	sr.serverMux.Handle(pattern, mv)
+	sr.patterns[pattern] = mv
+	return nil
+}
+
+func (sr *serveMuxRouter) Find(path string, values []string) (interface{}, []string) {
+	u := &url.URL{Path: unescape(path), RawPath: path}
+	h, _ := sr.serverMux.Handler(&http.Request{Method: http.MethodGet, URL: u})
+	mv, ok := h.(*muxValue)
+	if !ok {
+		// ServeMux redirects the unclean paths and "/tree" to "/tree/",
+		// the mux fixes them with PathPolicy. they may still be matched
+		// as they are, by a catch-all pattern such as "/".
+		mv = sr.match(path)
+		if mv == nil {
+			return nil, values
+		}
+	}
+	return mv.v, mv.p.values(path, values)
+}
+
+// match returns the most specific value whose pattern matches path.
+func (sr *serveMuxRouter) match(path string) *muxValue {
+	var best *muxValue
+	for _, mv := range sr.patterns {
+		if mv.p.matches(path) && (best == nil || comparePaths(mv.p.segs, best.p.segs) == moreSpecific) {
+			best = mv
+		}
+	}
+	return best
+}
+
+// NewRadixRouter returns a Router of radix tree, it doesn't allocate
+// when finding with enough capacity of values.
+func NewRadixRouter() Router {
+	return &radixRouter{root: new(radixNode)}
+}
+
+type radixRouter struct {
+	root *radixNode
+}
+
+// radixNode is a node of the tree, the static children are indexed by
+// their first byte. param matches a non-empty segment, multi the rest
+// of the path.
+type radixNode struct {
+	prefix  string
+	indices []byte
+	static  []*radixNode
+	param   *radixNode
+	multi   interface{}
+	value   interface{}
+}
+
+func (rr *radixRouter) Add(pattern string, v interface{}) error {
+	p, err := parsePattern(pattern, nil)
+	if err != nil {
+		return err
+	}
+	n := rr.root
+	static := ""
+	for _, seg := range p.segs {
+		static += "/"
+		switch {
+		case seg.multi:
+			n = n.insert(static)
+			if n.multi != nil {
+				return fmt.Errorf("jvmao: pattern %q registered twice", pattern)
+			}
+			n.multi = v
+			return nil
+		case seg.wild:
+			n = n.insert(static)
+			if n.param == nil {
+				n.param = new(radixNode)
+			}
+			n, static = n.param, ""
+		case !seg.end:
+			static += seg.s
+		}
+	}
+	n = n.insert(static)
+	if n.value != nil {
+		return fmt.Errorf("jvmao: pattern %q registered twice", pattern)
+	}
+	n.value = v
+	return nil
+}
+
+// insert returns the node of s under n, splits the nodes sharing
+// a prefix with s.
+func (n *radixNode) insert(s string) *radixNode {
+	for s != "" {
+		i := n.index(s[0])
+		if i < 0 {
+			child := &radixNode{prefix: s}
+			n.indices = append(n.indices, s[0])
+			n.static = append(n.static, child)
+			return child
+		}
+		child := n.static[i]
+		l := commonPrefix(s, child.prefix)
+		if l < len(child.prefix) {
+			split := &radixNode{
+				prefix:  child.prefix[:l],
+				indices: []byte{child.prefix[l]},
+				static:  []*radixNode{child},
+			}
+			child.prefix = child.prefix[l:]
+			n.static[i] = split
+			child = split
+		}
+		n, s = child, s[l:]
+	}
+	return n
+}
+
+func (n *radixNode) index(c byte) int {
+	for i, b := range n.indices {
+		if b == c {
+			return i
+		}
+	}
+	return -1
+}
+
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+func (rr *radixRouter) Find(path string, values []string) (interface{}, []string) {
+	return rr.root.find(path, values)
+}
+
+// find matches the path after the prefix of n, the static children are
+// tried before param, then multi.
+func (n *radixNode) find(path string, values []string) (interface{}, []string) {
+	if path == "" {
+		if n.value != nil {
+			return n.value, values
+		}
+		if n.multi != nil {
+			return n.multi, append(values, "")
+		}
+		return nil, values
+	}
+	if i := n.index(path[0]); i >= 0 {
+		child := n.static[i]
+		if strings.HasPrefix(path, child.prefix) {
+			if v, vs := child.find(path[len(child.prefix):], values); v != nil {
+				return v, vs
+			}
+		}
+	}
+	if n.param != nil {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		if end > 0 {
+			if v, vs := n.param.find(path[end:], append(values, unescape(path[:end]))); v != nil {
+				return v, vs
+			}
+		}
+	}
+	if n.multi != nil {
+		return n.multi, append(values, unescape(path))
+	}
+	return nil, values
+}
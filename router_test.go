@@ -0,0 +1,145 @@
+package jvmao
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var routers = map[string]func() Router{
+	"ServeMux": NewServeMuxRouter,
+	"Radix":    NewRadixRouter,
+}
+
+func TestRouters(t *testing.T) {
+
+	name := func(n string) HandlerFunc {
+		return func(c Context) error {
+			return c.String(http.StatusOK, n+" "+c.ParamValue("a")+" "+c.ParamValue("b"))
+		}
+	}
+
+	cases := []struct {
+		target string
+		code   int
+		body   string
+	}{
+		{"/", 200, "root  "},
+		{"/users", 200, "users  "},
+		{"/users/new", 200, "new-user  "},
+		{"/users/12", 200, "user 12 "},
+		{"/users/12/posts/7", 200, "post 12 7"},
+		{"/users/12/posts/new", 200, "new-post 12 "},
+		{"/users/12/files/a/b%20c", 200, "files 12 a/b c"},
+		{"/users/12/files/", 200, "files 12 "},
+		{"/users/a%2Fb", 200, "user a/b "},
+		{"/static/x.css", 200, "static x.css "},
+		{"/static/", 200, "static-index  "},
+		{"/u/x/y", 200, "u-static x "},
+		{"/u/x/z", 200, "u-param-z x "},
+		{"/u/y/z", 200, "u-param-z y "},
+		{"/users/12/posts", 404, ""},
+	}
+
+	for rn, newRouter := range routers {
+		jm := New()
+		jm.SetRouter(newRouter)
+		jm.GET("/{$}", "root", name("root"))
+		jm.GET("/users", "users", name("users"))
+		jm.GET("/users/new", "new-user", name("new-user"))
+		jm.GET("/users/:a", "user", name("user"))
+		jm.GET("/users/:a/posts/:b", "post", name("post"))
+		jm.GET("/users/:a/posts/new", "new-post", name("new-post"))
+		jm.GET("/users/:a/files/*b", "files", name("files"))
+		jm.GET("/static/*a", "static", name("static"))
+		jm.GET("/static/{$}", "static-index", name("static-index"))
+		jm.GET("/u/:a/y", "u-static", name("u-static"))
+		jm.GET("/u/:a/:b", "u-param", func(c Context) error { return nil })
+		jm.GET("/u/:a/z", "u-param-z", name("u-param-z"))
+
+		for _, cs := range cases {
+			rec := httptest.NewRecorder()
+			jm.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, cs.target, nil))
+			if rec.Code != cs.code || (cs.body != "" && rec.Body.String() != cs.body) {
+				t.Fatalf("%s: GET %s: %d %q", rn, cs.target, rec.Code, rec.Body.String())
+			}
+		}
+	}
+}
+
+type failRouter struct{ Router }
+
+func (failRouter) Add(pattern string, v interface{}) error {
+	return errors.New("fail " + pattern)
+}
+
+func TestSetRouterFails(t *testing.T) {
+
+	jm := New()
+	ok := func(c Context) error { return c.String(http.StatusOK, "ok") }
+	jm.GET("/", "index", ok)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("SetRouter: no panic")
+			}
+		}()
+		jm.SetRouter(func() Router { return failRouter{NewServeMuxRouter()} })
+	}()
+
+	// the old Router is kept for the routes registered after.
+	jm.Host("api.example.com").GET("/api", "api", ok)
+	jm.SetPathPolicy(PathPolicy{Mode: PathStrict})
+	for _, target := range []string{"/", "http://api.example.com/api"} {
+		rec := httptest.NewRecorder()
+		jm.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatal(target, rec.Code)
+		}
+	}
+}
+
+type discardWriter struct {
+	h http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.h }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+func benchmarkRouter(b *testing.B, newRouter func() Router) {
+	jm := New()
+	jm.SetRouter(newRouter)
+	h := func(c Context) error { return nil }
+	for _, p := range []string{
+		"/", "/users", "/users/:id", "/users/:id/posts", "/users/:id/posts/:post",
+		"/users/:id/followers", "/users/:id/following", "/repos/:owner/:repo",
+		"/repos/:owner/:repo/issues", "/repos/:owner/:repo/issues/:number",
+		"/repos/:owner/:repo/pulls", "/repos/:owner/:repo/contents/*path",
+		"/orgs/:org", "/orgs/:org/members", "/search/code", "/search/issues",
+	} {
+		jm.GET(p, "", h)
+	}
+	reqs := []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/users/arion/posts/12", nil),
+		httptest.NewRequest(http.MethodGet, "/repos/arion/jvmao/issues/7", nil),
+		httptest.NewRequest(http.MethodGet, "/repos/arion/jvmao/contents/a/b/c.go", nil),
+		httptest.NewRequest(http.MethodGet, "/search/code", nil),
+	}
+	w := &discardWriter{h: http.Header{}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		jm.ServeHTTP(w, reqs[i%len(reqs)])
+	}
+}
+
+func BenchmarkServeMuxRouter(b *testing.B) {
+	benchmarkRouter(b, NewServeMuxRouter)
+}
+
+func BenchmarkRadixRouter(b *testing.B) {
+	benchmarkRouter(b, NewRadixRouter)
+}
@@ -0,0 +1,69 @@
+package jvmao
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Serializer encodes and decodes the JSON of the Jvmao: Context.Json,
+// Context.BindForm, Context.JSONStream, Context.Negotiate, the JSON
+// error handler and the WebSocket messages.
+type Serializer interface {
+	// Serialize writes the JSON of v followed by a newline to w,
+	// indented by indent when it is not empty.
+	Serialize(w io.Writer, v any, indent string) error
+	// Deserialize decodes the JSON value read from r into v.
+	Deserialize(r io.Reader, v any) error
+}
+
+// JSONSerializer is the Serializer of encoding/json, the default one.
+type JSONSerializer struct {
+	// DisallowUnknownFields fails decoding an object key matching no
+	// field of the struct.
+	DisallowUnknownFields bool
+	// UseNumber decodes the numbers into an interface{} as json.Number.
+	UseNumber bool
+}
+
+// Serialize implements Serializer.
+func (s *JSONSerializer) Serialize(w io.Writer, v any, indent string) error {
+	enc := json.NewEncoder(w)
+	if indent != "" {
+		enc.SetIndent("", indent)
+	}
+	return enc.Encode(v)
+}
+
+// Deserialize implements Serializer.
+func (s *JSONSerializer) Deserialize(r io.Reader, v any) error {
+	dec := json.NewDecoder(r)
+	if s.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if s.UseNumber {
+		dec.UseNumber()
+	}
+	return dec.Decode(v)
+}
+
+// SetSerializer sets the Serializer of the JSON, nil restores the
+// JSONSerializer.
+func (jm *Jvmao) SetSerializer(s Serializer) {
+	if s == nil {
+		s = new(JSONSerializer)
+	}
+	jm.serializer.Store(&s)
+}
+
+// Serializer returns the Serializer of the JSON.
+func (jm *Jvmao) Serializer() Serializer {
+	return *jm.serializer.Load()
+}
+
+// jsonIndent is the indent of the JSON sent, in debug mode only.
+func (jm *Jvmao) jsonIndent() string {
+	if jm.Debug() {
+		return "  "
+	}
+	return ""
+}
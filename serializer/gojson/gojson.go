@@ -0,0 +1,44 @@
+// Package gojson is a jvmao.Serializer of github.com/goccy/go-json,
+// a faster encoding/json.
+package gojson
+
+import (
+	"io"
+
+	"github.com/goccy/go-json"
+
+	"github.com/arion-dsh/jvmao"
+)
+
+var _ jvmao.Serializer = (*Serializer)(nil)
+
+// Serializer encodes the JSON by go-json, set it by
+// Jvmao.SetSerializer.
+type Serializer struct {
+	// DisallowUnknownFields fails decoding an object key matching no
+	// field of the struct.
+	DisallowUnknownFields bool
+	// UseNumber decodes the numbers into an interface{} as json.Number.
+	UseNumber bool
+}
+
+// Serialize implements jvmao.Serializer.
+func (s *Serializer) Serialize(w io.Writer, v any, indent string) error {
+	enc := json.NewEncoder(w)
+	if indent != "" {
+		enc.SetIndent("", indent)
+	}
+	return enc.Encode(v)
+}
+
+// Deserialize implements jvmao.Serializer.
+func (s *Serializer) Deserialize(r io.Reader, v any) error {
+	dec := json.NewDecoder(r)
+	if s.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if s.UseNumber {
+		dec.UseNumber()
+	}
+	return dec.Decode(v)
+}
@@ -0,0 +1,116 @@
+package jvmao
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// upperSerializer is the JSONSerializer sending upper case JSON.
+type upperSerializer struct {
+	JSONSerializer
+}
+
+func (s *upperSerializer) Serialize(w io.Writer, v any, indent string) error {
+	var b strings.Builder
+	if err := s.JSONSerializer.Serialize(&b, v, indent); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, strings.ToUpper(b.String()))
+	return err
+}
+
+func TestSerializer(t *testing.T) {
+
+	jm := New()
+	jm.GET("/json", "json", func(c Context) error {
+		return c.Json(http.StatusCreated, map[string]int{"a": 1})
+	})
+	jm.GET("/bad", "bad", func(c Context) error {
+		return c.Json(http.StatusOK, make(chan int))
+	})
+	jm.POST("/bind", "bind", func(c Context) error {
+		var v struct {
+			A any `json:"a"`
+		}
+		if err := c.BindForm(&v); err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		_, isNumber := v.A.(json.Number)
+		return c.Json(http.StatusOK, isNumber)
+	})
+	jm.GET("/stream", "stream", func(c Context) error {
+		return c.JSONStream(http.StatusOK, func(yield func(any) bool) {
+			_ = yield(map[string]int{"a": 1}) && yield("b")
+		})
+	})
+	jm.GET("/negotiate", "negotiate", func(c Context) error {
+		return c.Negotiate(http.StatusOK, map[string]int{"a": 1})
+	})
+	jm.GET("/error", "error", func(c Context) error {
+		return NewHTTPError(http.StatusTeapot, "tea")
+	})
+	jm.SetHTTPErrorHandler(DefaultHttpJsonErrorHandler)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(HeaderContentType, MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		jm.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/json", "")
+	if rec.Code != http.StatusCreated || rec.Body.String() != "{\"a\":1}\n" ||
+		rec.Header().Get(HeaderContentType) != MIMEApplicationJSONUTF8 {
+		t.Fatal("json:", rec.Code, rec.Header(), rec.Body)
+	}
+	jm.OpenDebug()
+	if rec := do(http.MethodGet, "/json", ""); rec.Body.String() != "{\n  \"a\": 1\n}\n" {
+		t.Fatal("indent:", rec.Body)
+	}
+	jm.debug.Store(false)
+
+	// nothing is sent before the error of encoding.
+	rec = do(http.MethodGet, "/bad", "")
+	var he HTTPError
+	if err := json.Unmarshal(rec.Body.Bytes(), &he); err != nil || rec.Code != http.StatusInternalServerError ||
+		len(rec.Header().Values(HeaderContentType)) != 1 {
+		t.Fatal("encode error:", err, rec.Code, rec.Header(), rec.Body)
+	}
+
+	if rec := do(http.MethodPost, "/bind", `{"a":1,"b":2}`); rec.Body.String() != "false\n" {
+		t.Fatal("bind:", rec.Code, rec.Body)
+	}
+	jm.SetSerializer(&JSONSerializer{DisallowUnknownFields: true, UseNumber: true})
+	if rec := do(http.MethodPost, "/bind", `{"a":1,"b":2}`); rec.Code != http.StatusBadRequest {
+		t.Fatal("unknown field:", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPost, "/bind", `{"a":1}`); rec.Body.String() != "true\n" {
+		t.Fatal("use number:", rec.Code, rec.Body)
+	}
+
+	jm.SetSerializer(&upperSerializer{})
+	for target, want := range map[string]string{
+		"/json":      "{\"A\":1}\n",
+		"/stream":    "{\"A\":1}\n\"B\"\n",
+		"/negotiate": "{\"A\":1}\n",
+		"/error":     "{\"CODE\":418,\"MSG\":\"TEA\"}\n",
+	} {
+		if rec := do(http.MethodGet, target, ""); rec.Body.String() != want {
+			t.Fatal(target, rec.Body)
+		}
+	}
+
+	jm.SetSerializer(nil)
+	if _, ok := jm.Serializer().(*JSONSerializer); !ok {
+		t.Fatal("default serializer:", jm.Serializer())
+	}
+	if err := jm.Serializer().Deserialize(strings.NewReader("{"), new(any)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatal("deserialize:", err)
+	}
+}
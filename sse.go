@@ -0,0 +1,141 @@
+package jvmao
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrStreamClosed is returned by writing to a stream after it closed.
+var ErrStreamClosed = errors.New("jvmao: stream closed")
+
+// Event is a server-sent event, the empty fields are not sent.
+type Event struct {
+	ID    string
+	Event string
+	// Retry is the reconnection time of the client.
+	Retry time.Duration
+	// Data is sent in a "data" field by line.
+	Data string
+}
+
+// EventStream writes server-sent events to the client, the methods
+// are safe for concurrent use. it stops when the client disconnects
+// or the handler returns.
+type EventStream struct {
+	r *http.Request
+	w *Response
+
+	mu     sync.Mutex
+	closed bool
+	stop   chan struct{}
+	once   sync.Once
+}
+
+func newEventStream(c *context) *EventStream {
+	s := &EventStream{r: c.r, w: c.w, stop: make(chan struct{})}
+	h := c.w.Header()
+	h.Set(HeaderContentType, MIMETextEventStream)
+	h.Set(HeaderCacheControl, "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	if c.r.ProtoMajor == 1 {
+		h.Set("Connection", "keep-alive")
+	}
+	// the events are sent for longer than the write timeout of a server.
+	_ = http.NewResponseController(c.w).SetWriteDeadline(time.Time{})
+	c.w.WriteHeader(http.StatusOK)
+	c.w.Flush()
+	c.onFinish(s.Close)
+	return s
+}
+
+// LastEventID returns the id of the last event the client got before
+// reconnecting, resume the stream after it.
+func (s *EventStream) LastEventID() string {
+	return s.r.Header.Get(HeaderLastEventID)
+}
+
+// Send sends e, it returns the error of the request context when the
+// client is gone.
+func (s *EventStream) Send(e Event) error {
+	var b strings.Builder
+	if e.ID != "" {
+		b.WriteString("id: " + oneLine(e.ID) + "\n")
+	}
+	if e.Event != "" {
+		b.WriteString("event: " + oneLine(e.Event) + "\n")
+	}
+	if e.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(e.Retry.Milliseconds(), 10) + "\n")
+	}
+	data := strings.ReplaceAll(e.Data, "\r\n", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteByte('\n')
+	return s.write(b.String())
+}
+
+// Comment sends a comment, the clients ignore it.
+func (s *EventStream) Comment(text string) error {
+	var b strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		b.WriteString(": " + line + "\n")
+	}
+	b.WriteByte('\n')
+	return s.write(b.String())
+}
+
+// Heartbeat sends a comment every interval, so the proxies keep the
+// connection open, until the stream stops.
+func (s *EventStream) Heartbeat(interval time.Duration) {
+	done := s.r.Context().Done()
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if s.Comment("heartbeat") != nil {
+					return
+				}
+			case <-s.stop:
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the stream, the handler returning closes it too.
+func (s *EventStream) Close() {
+	s.once.Do(func() {
+		close(s.stop)
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+	})
+}
+
+func (s *EventStream) write(msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStreamClosed
+	}
+	if err := s.r.Context().Err(); err != nil {
+		return err
+	}
+	if _, err := s.w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	return http.NewResponseController(s.w).Flush()
+}
+
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
@@ -0,0 +1,99 @@
+package jvmao
+
+import (
+	"bufio"
+	ctx "context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// testServers serve HTTP/1.1, HTTP/2 over TLS as StartTLS and h2c
+// as Start.
+var testServers = map[string]func(http.Handler) (*httptest.Server, *http.Client){
+	"http/1.1": func(h http.Handler) (*httptest.Server, *http.Client) {
+		srv := httptest.NewServer(h)
+		return srv, srv.Client()
+	},
+	"http/2": func(h http.Handler) (*httptest.Server, *http.Client) {
+		srv := httptest.NewUnstartedServer(h)
+		srv.EnableHTTP2 = true
+		srv.StartTLS()
+		return srv, srv.Client()
+	},
+	"h2c": func(h http.Handler) (*httptest.Server, *http.Client) {
+		srv := httptest.NewServer(h2c.NewHandler(h, new(http2.Server)))
+		return srv, &http.Client{Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(cx ctx.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return new(net.Dialer).DialContext(cx, network, addr)
+			},
+		}}
+	},
+}
+
+func TestSSE(t *testing.T) {
+
+	done := make(chan error, 1)
+	jm := New()
+	jm.GET("/events", "events", func(c Context) error {
+		s := c.SSE()
+		s.Heartbeat(10 * time.Millisecond)
+		if err := s.Send(Event{ID: "1", Event: "build", Retry: time.Second, Data: "a\nb"}); err != nil {
+			return err
+		}
+		if err := s.Send(Event{Data: "resume " + s.LastEventID()}); err != nil {
+			return err
+		}
+		<-c.Done()
+		done <- s.Send(Event{Data: "gone"})
+		return nil
+	})
+
+	for name, newServer := range testServers {
+		srv, client := newServer(jm)
+		cx, cancel := ctx.WithCancel(ctx.Background())
+		req, _ := http.NewRequestWithContext(cx, http.MethodGet, srv.URL+"/events", nil)
+		req.Header.Set("Last-Event-ID", "7")
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if (name != "http/1.1") != (res.ProtoMajor == 2) || res.Header.Get(HeaderContentType) != MIMETextEventStream {
+			t.Fatal(name, res.Proto, res.Header)
+		}
+
+		br := bufio.NewReader(res.Body)
+		var lines []string
+		for len(lines) < 10 {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				t.Fatal(name, err)
+			}
+			lines = append(lines, strings.TrimSuffix(line, "\n"))
+		}
+		want := "id: 1|event: build|retry: 1000|data: a|data: b||data: resume 7||: heartbeat|"
+		if got := strings.Join(lines, "|"); got != want {
+			t.Fatalf("%s: got %q", name, got)
+		}
+
+		cancel()
+		res.Body.Close()
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Fatal(name, "sent after the client disconnected")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal(name, "the handler didn't stop")
+		}
+		srv.Close()
+	}
+}
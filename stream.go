@@ -0,0 +1,131 @@
+package jvmao
+
+import (
+	"io"
+	"iter"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// MIMEApplicationNDJSON is the content type of Context.JSONStream.
+const MIMEApplicationNDJSON = "application/x-ndjson"
+
+// StreamOptions sets when the streamed responses of Context.Stream,
+// Context.JSONStream and Context.Pipe are flushed to the client.
+type StreamOptions struct {
+	// FlushSize flushes once that many bytes are written since the last
+	// flush, 0 flushes every write.
+	FlushSize int
+	// FlushInterval flushes the bytes written since the last flush
+	// every interval, 0 waits for FlushSize.
+	FlushInterval time.Duration
+}
+
+// DefaultStreamOptions flushes every 32KB or every second.
+var DefaultStreamOptions = StreamOptions{
+	FlushSize:     32 << 10,
+	FlushInterval: time.Second,
+}
+
+// streamWriter writes a streamed response, it fails once the request
+// context is done.
+type streamWriter struct {
+	c    *context
+	opts StreamOptions
+
+	mu      sync.Mutex
+	pending int
+}
+
+// Write implements io.Writer.
+func (s *streamWriter) Write(b []byte) (int, error) {
+	if err := s.c.r.Context().Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, err := s.c.w.Write(b)
+	s.pending += n
+	if err == nil && s.pending >= s.opts.FlushSize {
+		s.flush()
+	}
+	return n, err
+}
+
+// flush is called with mu held.
+func (s *streamWriter) flush() {
+	s.pending = 0
+	s.c.w.Flush()
+}
+
+// run flushes every interval until stop is closed.
+func (s *streamWriter) run(stop <-chan struct{}) {
+	t := time.NewTicker(s.opts.FlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			s.mu.Lock()
+			if s.pending > 0 {
+				s.flush()
+			}
+			s.mu.Unlock()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (c *context) Pipe(statusCode int, contentType string, fn func(w io.Writer) error) error {
+	s := &streamWriter{c: c, opts: *c.jm.streamOpts.Load()}
+	if contentType != "" {
+		c.setHct(contentType)
+	}
+	// a large body is sent for longer than the write timeout of a server.
+	_ = http.NewResponseController(c.w).SetWriteDeadline(time.Time{})
+	c.WriteHeader(statusCode)
+
+	if s.opts.FlushInterval > 0 {
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			s.run(stop)
+			close(done)
+		}()
+		defer func() {
+			close(stop)
+			<-done
+		}()
+	}
+
+	err := fn(s)
+	if err == nil {
+		err = c.r.Context().Err()
+	}
+	s.mu.Lock()
+	if err == nil {
+		s.flush()
+	}
+	s.mu.Unlock()
+	return err
+}
+
+func (c *context) Stream(statusCode int, contentType string, r io.Reader) error {
+	return c.Pipe(statusCode, contentType, func(w io.Writer) error {
+		_, err := io.Copy(w, r)
+		return err
+	})
+}
+
+func (c *context) JSONStream(statusCode int, seq iter.Seq[any]) error {
+	return c.Pipe(statusCode, MIMEApplicationNDJSON, func(w io.Writer) error {
+		s := c.jm.Serializer()
+		for v := range seq {
+			if err := s.Serialize(w, v, ""); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
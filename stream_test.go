@@ -0,0 +1,126 @@
+package jvmao
+
+import (
+	"bufio"
+	ctx "context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+
+	jm := New()
+	jm.GET("/stream", "stream", func(c Context) error {
+		return c.Stream(http.StatusCreated, MIMETextPlain, strings.NewReader("large body"))
+	})
+	jm.GET("/json", "json", func(c Context) error {
+		return c.JSONStream(http.StatusOK, func(yield func(any) bool) {
+			for i := range 3 {
+				if !yield(map[string]int{"n": i}) {
+					return
+				}
+			}
+		})
+	})
+
+	rec := httptest.NewRecorder()
+	jm.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	if rec.Code != http.StatusCreated || rec.Body.String() != "large body" || !rec.Flushed ||
+		rec.Header().Get(HeaderContentType) != MIMETextPlain {
+		t.Fatal("stream:", rec.Code, rec.Header(), rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	jm.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/json", nil))
+	if rec.Body.String() != "{\"n\":0}\n{\"n\":1}\n{\"n\":2}\n" ||
+		rec.Header().Get(HeaderContentType) != MIMEApplicationNDJSON {
+		t.Fatal("json stream:", rec.Header(), rec.Body)
+	}
+}
+
+func TestStreamFlush(t *testing.T) {
+
+	for name, opts := range map[string]StreamOptions{
+		"size":     {FlushSize: 4},
+		"interval": {FlushSize: 1 << 20, FlushInterval: 10 * time.Millisecond},
+	} {
+		t.Run(name, func(t *testing.T) {
+			next := make(chan struct{})
+			jm := New()
+			jm.SetStreamOptions(opts)
+			jm.GET("/", "pipe", func(c Context) error {
+				return c.Pipe(http.StatusOK, MIMETextPlain, func(w io.Writer) error {
+					for _, line := range []string{"one\n", "two\n"} {
+						if _, err := io.WriteString(w, line); err != nil {
+							return err
+						}
+						<-next
+					}
+					return nil
+				})
+			})
+			srv := httptest.NewServer(jm)
+			defer srv.Close()
+
+			res, err := http.Get(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			br := bufio.NewReader(res.Body)
+			for _, want := range []string{"one\n", "two\n"} {
+				// the line is read before the handler writes the next.
+				if line, err := br.ReadString('\n'); err != nil || line != want {
+					t.Fatal(line, err)
+				}
+				next <- struct{}{}
+			}
+		})
+	}
+}
+
+func TestStreamCancel(t *testing.T) {
+
+	done := make(chan error, 1)
+	jm := New()
+	jm.GET("/", "pipe", func(c Context) error {
+		err := c.Pipe(http.StatusOK, MIMETextPlain, func(w io.Writer) error {
+			for {
+				if _, err := io.WriteString(w, strings.Repeat("a", 1024)); err != nil {
+					return err
+				}
+			}
+		})
+		done <- err
+		return err
+	})
+	srv := httptest.NewServer(jm)
+	defer srv.Close()
+
+	cx, cancel := ctx.WithCancel(ctx.Background())
+	req, _ := http.NewRequestWithContext(cx, http.MethodGet, srv.URL, nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(res.Body, make([]byte, 4096)); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	res.Body.Close()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ctx.Canceled) && !strings.Contains(err.Error(), "broken pipe") &&
+			!strings.Contains(err.Error(), "connection reset") {
+			t.Fatal("cancel:", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stream did not stop")
+	}
+}
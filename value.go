@@ -0,0 +1,30 @@
+package jvmao
+
+import ctx "context"
+
+// Key is a typed key of the Context storage. keys are compared by
+// their address, so the keys of different packages never collide.
+type Key[T any] struct {
+	name string
+}
+
+// NewKey returns a new key, name is for debugging only.
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+func (k *Key[T]) String() string {
+	return "jvmao.Key(" + k.name + ")"
+}
+
+// SetValue sets v with key for the next handlers. it is stored in the
+// request context, so the libraries given the Context find it too.
+func SetValue[T any](c Context, key *Key[T], v T) {
+	c.WithContext(ctx.WithValue(c.Request().Context(), key, v))
+}
+
+// Value returns the value set with key.
+func Value[T any](c ctx.Context, key *Key[T]) (T, bool) {
+	v, ok := c.Value(key).(T)
+	return v, ok
+}
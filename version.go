@@ -0,0 +1,87 @@
+package jvmao
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// VersionSelector returns the API version asked by the request,
+// "" when it asks none.
+type VersionSelector func(r *http.Request) string
+
+// Versioning picks the version of the requests to the routes registered
+// in the groups of Jvmao.Version. versions are compared as strings.
+type Versioning struct {
+	// Selectors are tried in order, the first version found is used.
+	Selectors []VersionSelector
+	// Default is the version of the requests asking none.
+	Default string
+}
+
+// version returns the version asked by r.
+func (v *Versioning) version(r *http.Request) string {
+	for _, s := range v.Selectors {
+		if ver := s(r); ver != "" {
+			return ver
+		}
+	}
+	return v.Default
+}
+
+// HeaderVersion selects the version in the header, such as
+// "X-API-Version: 2".
+func HeaderVersion(name string) VersionSelector {
+	return func(r *http.Request) string {
+		return strings.TrimSpace(r.Header.Get(name))
+	}
+}
+
+// QueryVersion selects the version in the query param.
+func QueryVersion(name string) VersionSelector {
+	return func(r *http.Request) string {
+		return r.URL.Query().Get(name)
+	}
+}
+
+// AcceptVersion selects the version in the media types of the Accept
+// header, as the vendor subtype "application/vnd.acme.v2+json" or the
+// parameter "application/json; version=2". both give "2".
+func AcceptVersion() VersionSelector {
+	return func(r *http.Request) string {
+		for _, accept := range r.Header.Values(HeaderAccept) {
+			for _, s := range strings.Split(accept, ",") {
+				if ver := mediaTypeVersion(s); ver != "" {
+					return ver
+				}
+			}
+		}
+		return ""
+	}
+}
+
+func mediaTypeVersion(s string) string {
+	mt, params, err := mime.ParseMediaType(s)
+	if err != nil {
+		return ""
+	}
+	if ver := params["version"]; ver != "" {
+		return ver
+	}
+	_, sub, _ := strings.Cut(mt, "/")
+	sub, _, _ = strings.Cut(sub, "+")
+	if !strings.HasPrefix(sub, "vnd.") {
+		return ""
+	}
+	last := sub[strings.LastIndexByte(sub, '.')+1:]
+	if len(last) > 1 && last[0] == 'v' {
+		return last[1:]
+	}
+	return ""
+}
+
+// DefaultNotAcceptableHandler returns a 406 HTTPError sent by the
+// HTTPErrorHandler.
+func DefaultNotAcceptableHandler(c Context) error {
+	return NewHTTPError(http.StatusNotAcceptable, "not acceptable")
+}
@@ -0,0 +1,695 @@
+package jvmao
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// MessageType is the type of a WebSocket message.
+type MessageType int
+
+const (
+	TextMessage   MessageType = 1
+	BinaryMessage MessageType = 2
+)
+
+// the opcodes of the frames.
+const (
+	opContinuation = 0
+	opText         = 1
+	opBinary       = 2
+	opClose        = 8
+	opPing         = 9
+	opPong         = 10
+)
+
+// The close codes of RFC 6455 section 7.4.
+const (
+	CloseNormal             = 1000
+	CloseGoingAway          = 1001
+	CloseProtocolError      = 1002
+	CloseUnsupportedData    = 1003
+	CloseNoStatus           = 1005
+	CloseAbnormal           = 1006
+	CloseInvalidPayload     = 1007
+	ClosePolicyViolation    = 1008
+	CloseTooBig             = 1009
+	CloseMandatoryExtension = 1010
+	CloseInternalError      = 1011
+)
+
+// CloseError is returned by reading a WebSocket closed by the peer, or
+// by a protocol error with the code sent to the peer.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("jvmao: websocket closed: %d %s", e.Code, e.Reason)
+}
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocketOptions configures the upgrade of Upgrade.
+type WebSocketOptions struct {
+	// Subprotocols are the protocols the server speaks by preference,
+	// the first one the client asks is selected.
+	Subprotocols []string
+	// CheckOrigin accepts the origin of the request, the origins of
+	// another host are refused by default.
+	CheckOrigin func(r *http.Request) bool
+	// Compression negotiates permessage-deflate when the client offers it.
+	Compression bool
+	// ReadLimit is the max size of a message read, 32 MB by default.
+	ReadLimit int64
+}
+
+// WebSocket is a WebSocket connection. a goroutine may read while
+// another writes, the control frames can be sent concurrently.
+// it closes when the handler returns.
+type WebSocket struct {
+	br     *bufio.Reader
+	w      io.Writer
+	flush  func() error
+	close  func() error
+	server bool
+	// ser encodes the JSON messages.
+	ser Serializer
+
+	subprotocol string
+	compress    bool
+	readLimit   int64
+
+	// dict is the tail of the messages inflated, the peer may
+	// refer to it with context takeover.
+	dict    []byte
+	readErr error
+
+	wmu       sync.Mutex
+	fw        *flate.Writer
+	closeSent bool
+	closeOnce sync.Once
+}
+
+// isWebSocketConnect reports whether r is the extended CONNECT of a
+// WebSocket over HTTP/2.
+func isWebSocketConnect(r *http.Request) bool {
+	return r.ProtoMajor == 2 && r.Method == http.MethodConnect && r.Header.Get(":protocol") == "websocket"
+}
+
+// Upgrade answers the WebSocket handshake of the request, RFC 6455 over
+// HTTP/1.1 and RFC 8441 over HTTP/2. the handshake errors are HTTPErrors
+// to return from the handler.
+//
+// over HTTP/2 the client sends an extended CONNECT, it is served by the
+// GET route of the path. the HTTP/2 servers of net/http and
+// golang.org/x/net/http2, as StartTLS's, accept it with
+// GODEBUG=http2xconnect=1 only.
+func Upgrade(c Context, opts WebSocketOptions) (*WebSocket, error) {
+	r, w := c.Request(), c.Response()
+	if opts.ReadLimit <= 0 {
+		opts.ReadLimit = maxMemory
+	}
+	checkOrigin := opts.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+
+	h2 := r.ProtoMajor == 2
+	switch {
+	case h2 && !isWebSocketConnect(r):
+		return nil, NewHTTPError(http.StatusBadRequest, "websocket: not an extended CONNECT request")
+	case !h2 && r.Method != http.MethodGet:
+		return nil, NewHTTPError(http.StatusMethodNotAllowed, "websocket: method not GET")
+	case !h2 && (!headerHasToken(r.Header, HeaderConnection, "upgrade") || !headerHasToken(r.Header, HeaderUpgrade, "websocket")):
+		return nil, NewHTTPError(http.StatusBadRequest, "websocket: not an upgrade request")
+	}
+	if r.Header.Get(HeaderSecWebSocketVersion) != "13" {
+		w.Header().Set(HeaderSecWebSocketVersion, "13")
+		return nil, NewHTTPError(http.StatusUpgradeRequired, "websocket: unsupported version")
+	}
+	key := r.Header.Get(HeaderSecWebSocketKey)
+	if b, err := base64.StdEncoding.DecodeString(key); !h2 && (err != nil || len(b) != 16) {
+		return nil, NewHTTPError(http.StatusBadRequest, "websocket: bad Sec-WebSocket-Key")
+	}
+	if !checkOrigin(r) {
+		return nil, NewHTTPError(http.StatusForbidden, "websocket: origin not allowed")
+	}
+
+	ws := &WebSocket{server: true, readLimit: opts.ReadLimit}
+	header := http.Header{}
+	if ws.subprotocol = selectSubprotocol(r, opts.Subprotocols); ws.subprotocol != "" {
+		header.Set(HeaderSecWebSocketProtocol, ws.subprotocol)
+	}
+	if opts.Compression && acceptDeflate(r.Header) {
+		ws.compress = true
+		header.Set(HeaderSecWebSocketExtensions, "permessage-deflate; server_no_context_takeover")
+	}
+
+	if h2 {
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(http.StatusOK)
+		rc := http.NewResponseController(w)
+		if err := rc.Flush(); err != nil {
+			return nil, err
+		}
+		ws.br = bufio.NewReader(r.Body)
+		ws.w, ws.flush, ws.close = w, rc.Flush, r.Body.Close
+	} else {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if errors.Is(err, http.ErrNotSupported) {
+			return nil, NewHTTPError(http.StatusInternalServerError, "websocket: connection can't be hijacked")
+		}
+		if err != nil {
+			return nil, err
+		}
+		w.Status, w.wroteHeader = http.StatusSwitchingProtocols, true
+		header.Set(HeaderUpgrade, "websocket")
+		header.Set(HeaderConnection, "Upgrade")
+		header.Set(HeaderSecWebSocketAccept, acceptKey(key))
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+		_ = header.Write(brw)
+		brw.WriteString("\r\n")
+		if err := brw.Flush(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		ws.br = brw.Reader
+		ws.w, ws.flush, ws.close = brw.Writer, brw.Writer.Flush, conn.Close
+	}
+	if cx, ok := c.(*context); ok {
+		ws.ser = cx.jm.Serializer()
+		cx.onFinish(func() { ws.closeNow() })
+	}
+	return ws, nil
+}
+
+// Subprotocol returns the subprotocol selected in the handshake.
+func (ws *WebSocket) Subprotocol() string {
+	return ws.subprotocol
+}
+
+// ReadMessage reads the next message, the fragments are joined and the
+// pings answered. it returns a *CloseError when the peer closes.
+func (ws *WebSocket) ReadMessage() (MessageType, []byte, error) {
+	if ws.readErr != nil {
+		return 0, nil, ws.readErr
+	}
+	var (
+		typ        MessageType
+		compressed bool
+		msg        []byte
+	)
+	for {
+		fin, rsv1, op, payload, err := ws.readFrame()
+		if err != nil {
+			return 0, nil, ws.fail(err)
+		}
+		switch op {
+		case opPing:
+			if err := ws.writeControl(opPong, payload); err != nil {
+				return 0, nil, ws.fail(err)
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			return 0, nil, ws.fail(ws.closeFrame(payload))
+		case opText, opBinary:
+			if typ != 0 {
+				return 0, nil, ws.fail(protocolError("message started within a message"))
+			}
+			typ, compressed = MessageType(op), rsv1
+		case opContinuation:
+			if typ == 0 {
+				return 0, nil, ws.fail(protocolError("continuation without a message"))
+			}
+		}
+		if int64(len(msg)+len(payload)) > ws.readLimit {
+			return 0, nil, ws.fail(&CloseError{CloseTooBig, "message too big"})
+		}
+		msg = append(msg, payload...)
+		if fin {
+			break
+		}
+	}
+	if compressed {
+		var err error
+		if msg, err = ws.inflate(msg); err != nil {
+			return 0, nil, ws.fail(err)
+		}
+	}
+	if typ == TextMessage && !utf8.Valid(msg) {
+		return 0, nil, ws.fail(&CloseError{CloseInvalidPayload, "invalid UTF-8"})
+	}
+	return typ, msg, nil
+}
+
+// ReadText reads a message as text.
+func (ws *WebSocket) ReadText() (string, error) {
+	_, b, err := ws.ReadMessage()
+	return string(b), err
+}
+
+// ReadBinary reads a message as bytes.
+func (ws *WebSocket) ReadBinary() ([]byte, error) {
+	_, b, err := ws.ReadMessage()
+	return b, err
+}
+
+// ReadJSON reads a message and decodes it into v.
+func (ws *WebSocket) ReadJSON(v interface{}) error {
+	_, b, err := ws.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return ws.serializer().Deserialize(bytes.NewReader(b), v)
+}
+
+// WriteMessage sends data in a message of typ.
+func (ws *WebSocket) WriteMessage(typ MessageType, data []byte) error {
+	ws.wmu.Lock()
+	defer ws.wmu.Unlock()
+	rsv1 := false
+	if ws.compress {
+		data, rsv1 = ws.deflate(data, true), true
+	}
+	return ws.writeFrame(true, rsv1, byte(typ), data)
+}
+
+// WriteText sends s in a text message.
+func (ws *WebSocket) WriteText(s string) error {
+	return ws.WriteMessage(TextMessage, []byte(s))
+}
+
+// WriteBinary sends b in a binary message.
+func (ws *WebSocket) WriteBinary(b []byte) error {
+	return ws.WriteMessage(BinaryMessage, b)
+}
+
+// WriteJSON sends v encoded in a text message.
+func (ws *WebSocket) WriteJSON(v interface{}) error {
+	var buf bytes.Buffer
+	if err := ws.serializer().Serialize(&buf, v, ""); err != nil {
+		return err
+	}
+	return ws.WriteMessage(TextMessage, bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+}
+
+func (ws *WebSocket) serializer() Serializer {
+	if ws.ser == nil {
+		return new(JSONSerializer)
+	}
+	return ws.ser
+}
+
+// NextWriter returns a writer of a message of typ sent in fragments,
+// a frame by Write. Close sends the last frame. no other message may
+// be written until it is closed.
+func (ws *WebSocket) NextWriter(typ MessageType) io.WriteCloser {
+	return &fragmentWriter{ws: ws, op: byte(typ)}
+}
+
+type fragmentWriter struct {
+	ws     *WebSocket
+	op     byte
+	closed bool
+}
+
+func (fw *fragmentWriter) Write(p []byte) (int, error) {
+	if fw.closed {
+		return 0, ErrStreamClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := fw.frame(false, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (fw *fragmentWriter) Close() error {
+	if fw.closed {
+		return nil
+	}
+	fw.closed = true
+	return fw.frame(true, nil)
+}
+
+// frame sends p in the next frame, the first frame has the opcode of
+// the message and the others continue it.
+func (fw *fragmentWriter) frame(fin bool, p []byte) error {
+	ws := fw.ws
+	ws.wmu.Lock()
+	defer ws.wmu.Unlock()
+	op, rsv1 := fw.op, false
+	if op != opContinuation {
+		rsv1 = ws.compress
+		fw.op = opContinuation
+	}
+	if ws.compress {
+		p = ws.deflate(p, fin)
+	}
+	return ws.writeFrame(fin, rsv1, op, p)
+}
+
+// Ping sends a ping, the peer answers with a pong.
+func (ws *WebSocket) Ping(data []byte) error {
+	return ws.writeControl(opPing, data)
+}
+
+// Close sends a normal close and closes the connection.
+func (ws *WebSocket) Close() error {
+	return ws.CloseWithReason(CloseNormal, "")
+}
+
+// CloseWithReason sends a close with code and reason, then closes
+// the connection.
+func (ws *WebSocket) CloseWithReason(code int, reason string) error {
+	err := ws.writeClose(code, reason)
+	ws.closeNow()
+	return err
+}
+
+func (ws *WebSocket) closeNow() {
+	ws.closeOnce.Do(func() {
+		// closing first unblocks a write in progress.
+		_ = ws.close()
+		ws.wmu.Lock()
+		ws.closeSent = true
+		ws.wmu.Unlock()
+	})
+}
+
+// fail sends the close of err and closes the connection, the next
+// reads return err.
+func (ws *WebSocket) fail(err error) error {
+	var ce *CloseError
+	if errors.As(err, &ce) {
+		code := ce.Code
+		if code == CloseNoStatus {
+			code = 0
+		}
+		_ = ws.writeClose(code, ce.Reason)
+	}
+	ws.closeNow()
+	ws.readErr = err
+	return err
+}
+
+// closeFrame returns the CloseError of the payload of a close frame.
+func (ws *WebSocket) closeFrame(payload []byte) error {
+	switch {
+	case len(payload) == 0:
+		return &CloseError{Code: CloseNoStatus}
+	case len(payload) == 1:
+		return protocolError("bad close frame")
+	}
+	code := int(binary.BigEndian.Uint16(payload))
+	if !validCloseCode(code) {
+		return protocolError("bad close code")
+	}
+	reason := payload[2:]
+	if !utf8.Valid(reason) {
+		return &CloseError{CloseInvalidPayload, "invalid UTF-8"}
+	}
+	return &CloseError{code, string(reason)}
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+func protocolError(reason string) error {
+	return &CloseError{CloseProtocolError, reason}
+}
+
+// readFrame reads a frame, the payload is unmasked.
+func (ws *WebSocket) readFrame() (fin, rsv1 bool, op byte, payload []byte, err error) {
+	var h [2]byte
+	if _, err = io.ReadFull(ws.br, h[:]); err != nil {
+		return
+	}
+	fin, rsv1, op = h[0]&0x80 != 0, h[0]&0x40 != 0, h[0]&0x0f
+	masked := h[1]&0x80 != 0
+	n := uint64(h[1] & 0x7f)
+	control := op >= opClose
+
+	switch {
+	case h[0]&0x30 != 0:
+		err = protocolError("reserved bits set")
+	case rsv1 && (!ws.compress || control || op == opContinuation):
+		err = protocolError("unexpected compressed frame")
+	case op > opBinary && !control, op > opPong:
+		err = protocolError("reserved opcode")
+	case control && (!fin || n > 125):
+		err = protocolError("bad control frame")
+	case masked != ws.server:
+		err = protocolError("bad frame mask")
+	}
+	if err != nil {
+		return
+	}
+
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, err = io.ReadFull(ws.br, b[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err = io.ReadFull(ws.br, b[:]); err != nil {
+			return
+		}
+		if n = binary.BigEndian.Uint64(b[:]); n>>63 != 0 {
+			err = protocolError("bad frame length")
+			return
+		}
+	}
+	if n > uint64(ws.readLimit) {
+		err = &CloseError{CloseTooBig, "message too big"}
+		return
+	}
+	var key [4]byte
+	if masked {
+		if _, err = io.ReadFull(ws.br, key[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(ws.br, payload); err != nil {
+		return
+	}
+	if masked {
+		maskBytes(key, payload)
+	}
+	return
+}
+
+func (ws *WebSocket) writeControl(op byte, data []byte) error {
+	if len(data) > 125 {
+		return errors.New("jvmao: websocket: control frame too big")
+	}
+	ws.wmu.Lock()
+	defer ws.wmu.Unlock()
+	return ws.writeFrame(true, false, op, data)
+}
+
+func (ws *WebSocket) writeClose(code int, reason string) error {
+	var payload []byte
+	if code != 0 {
+		payload = binary.BigEndian.AppendUint16(nil, uint16(code))
+		payload = append(payload, reason...)
+	}
+	ws.wmu.Lock()
+	defer ws.wmu.Unlock()
+	if ws.closeSent {
+		return nil
+	}
+	err := ws.writeFrame(true, false, opClose, payload)
+	ws.closeSent = true
+	return err
+}
+
+// writeFrame sends a frame, the caller holds wmu.
+func (ws *WebSocket) writeFrame(fin, rsv1 bool, op byte, payload []byte) error {
+	if ws.closeSent {
+		return ErrStreamClosed
+	}
+	h := make([]byte, 2, 14)
+	if fin {
+		h[0] |= 0x80
+	}
+	if rsv1 {
+		h[0] |= 0x40
+	}
+	h[0] |= op
+	n := len(payload)
+	switch {
+	case n <= 125:
+		h[1] = byte(n)
+	case n <= 0xffff:
+		h[1] = 126
+		h = binary.BigEndian.AppendUint16(h, uint16(n))
+	default:
+		h[1] = 127
+		h = binary.BigEndian.AppendUint64(h, uint64(n))
+	}
+	if !ws.server {
+		var key [4]byte
+		_, _ = rand.Read(key[:])
+		h[1] |= 0x80
+		h = append(h, key[:]...)
+		payload = append([]byte(nil), payload...)
+		maskBytes(key, payload)
+	}
+	if _, err := ws.w.Write(h); err != nil {
+		return err
+	}
+	if _, err := ws.w.Write(payload); err != nil {
+		return err
+	}
+	return ws.flush()
+}
+
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i&3]
+	}
+}
+
+// deflateTail ends the compressed data of a message, it is removed
+// when sending and added back when receiving.
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff}
+
+// deflate compresses a message or a fragment of it, the writer is
+// reset after the last one as server_no_context_takeover. the caller
+// holds wmu.
+func (ws *WebSocket) deflate(p []byte, last bool) []byte {
+	var buf bytes.Buffer
+	if ws.fw == nil {
+		ws.fw, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	} else {
+		ws.fw.Reset(&buf)
+	}
+	_, _ = ws.fw.Write(p)
+	_ = ws.fw.Flush()
+	b := buf.Bytes()
+	if last {
+		b = bytes.TrimSuffix(b, deflateTail)
+		ws.fw.Reset(io.Discard)
+	}
+	return b
+}
+
+// inflate decompresses a message, the tail of the messages is kept
+// for the context takeover of the peer.
+func (ws *WebSocket) inflate(p []byte) ([]byte, error) {
+	// the tail ends the message then a final empty block ends the stream.
+	src := io.MultiReader(bytes.NewReader(p), bytes.NewReader(deflateTail),
+		bytes.NewReader([]byte{0x01, 0x00, 0x00, 0xff, 0xff}))
+	fr := flate.NewReaderDict(src, ws.dict)
+	defer fr.Close()
+	b, err := io.ReadAll(io.LimitReader(fr, ws.readLimit+1))
+	if err != nil {
+		return nil, &CloseError{CloseInvalidPayload, "bad compressed message"}
+	}
+	if int64(len(b)) > ws.readLimit {
+		return nil, &CloseError{CloseTooBig, "message too big"}
+	}
+	ws.dict = append(ws.dict, b...)
+	if len(ws.dict) > 1<<15 {
+		ws.dict = append([]byte(nil), ws.dict[len(ws.dict)-1<<15:]...)
+	}
+	return b, nil
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// headerHasToken reports whether the comma separated values of the
+// header have token.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func selectSubprotocol(r *http.Request, protocols []string) string {
+	for _, p := range protocols {
+		if headerHasToken(r.Header, HeaderSecWebSocketProtocol, p) {
+			return p
+		}
+	}
+	return ""
+}
+
+// acceptDeflate reports whether an offer of permessage-deflate can be
+// accepted, the window of the server can't be smaller.
+func acceptDeflate(h http.Header) bool {
+	for _, v := range h.Values(HeaderSecWebSocketExtensions) {
+	offers:
+		for _, offer := range strings.Split(v, ",") {
+			params := strings.Split(offer, ";")
+			if strings.TrimSpace(params[0]) != "permessage-deflate" {
+				continue
+			}
+			for _, p := range params[1:] {
+				k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+				switch k {
+				case "server_no_context_takeover", "client_no_context_takeover", "client_max_window_bits":
+				case "server_max_window_bits":
+					if strings.Trim(v, `"`) != "15" {
+						continue offers
+					}
+				default:
+					continue offers
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,237 @@
+package jvmao
+
+import (
+	"bufio"
+	ctx "context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+// echoWebSocket echoes the messages until the client closes.
+func echoWebSocket(t *testing.T, closed chan<- error) *Jvmao {
+	jm := New()
+	jm.GET("/ws", "ws", func(c Context) error {
+		ws, err := Upgrade(c, WebSocketOptions{Subprotocols: []string{"v2", "v1"}, Compression: true, ReadLimit: 1 << 16})
+		if err != nil {
+			return err
+		}
+		for {
+			typ, b, err := ws.ReadMessage()
+			if err != nil {
+				closed <- err
+				return nil
+			}
+			if err := ws.WriteMessage(typ, b); err != nil {
+				return err
+			}
+		}
+	})
+	return jm
+}
+
+// dialWebSocket opens a client WebSocket to the path of srv over HTTP/1.1.
+func dialWebSocket(t *testing.T, srv *httptest.Server, header http.Header) (*WebSocket, *http.Response) {
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/ws", nil)
+	req.Header = header
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	req.Header.Set(HeaderConnection, "Upgrade")
+	req.Header.Set(HeaderUpgrade, "websocket")
+	req.Header.Set(HeaderSecWebSocketKey, key)
+	req.Header.Set(HeaderSecWebSocketVersion, "13")
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, res
+	}
+	if res.Header.Get(HeaderSecWebSocketAccept) != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatal("accept key:", res.Header)
+	}
+	return clientWebSocket(br, conn, func() error { return nil }, conn.Close, res), res
+}
+
+func clientWebSocket(br *bufio.Reader, w io.Writer, flush, close func() error, res *http.Response) *WebSocket {
+	return &WebSocket{
+		br: br, w: w, flush: flush, close: close,
+		readLimit:   1 << 20,
+		subprotocol: res.Header.Get(HeaderSecWebSocketProtocol),
+		compress:    strings.HasPrefix(res.Header.Get(HeaderSecWebSocketExtensions), "permessage-deflate"),
+	}
+}
+
+// testWebSocketEcho talks to echoWebSocket over ws.
+func testWebSocketEcho(t *testing.T, ws *WebSocket, closed <-chan error) {
+	if err := ws.WriteText("hello"); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := ws.ReadText(); err != nil || s != "hello" {
+		t.Fatal("text:", s, err)
+	}
+	if err := ws.WriteBinary([]byte{0, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if typ, b, err := ws.ReadMessage(); err != nil || typ != BinaryMessage || string(b) != "\x00\x01\x02" {
+		t.Fatal("binary:", typ, b, err)
+	}
+	if err := ws.WriteJSON(map[string]int{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+	var v map[string]int
+	if err := ws.ReadJSON(&v); err != nil || v["n"] != 1 {
+		t.Fatal("json:", v, err)
+	}
+
+	// a ping between the fragments is answered.
+	w := ws.NextWriter(TextMessage)
+	_, _ = io.WriteString(w, strings.Repeat("a", 200))
+	if err := ws.Ping([]byte("p")); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.WriteString(w, "b")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := ws.ReadText(); err != nil || s != strings.Repeat("a", 200)+"b" {
+		t.Fatal("fragments:", len(s), err)
+	}
+
+	if err := ws.writeClose(4000, "bye"); err != nil {
+		t.Fatal(err)
+	}
+	var ce *CloseError
+	if err := <-closed; !errors.As(err, &ce) || ce.Code != 4000 || ce.Reason != "bye" {
+		t.Fatal("server close:", err)
+	}
+	if _, _, err := ws.ReadMessage(); !errors.As(err, &ce) || ce.Code != 4000 {
+		t.Fatal("close echo:", err)
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+
+	closed := make(chan error, 1)
+	srv := httptest.NewServer(echoWebSocket(t, closed))
+	defer srv.Close()
+
+	for _, ext := range []string{"", "permessage-deflate; client_max_window_bits"} {
+		header := http.Header{}
+		header.Set(HeaderSecWebSocketProtocol, "v1, v2")
+		header.Set(HeaderSecWebSocketExtensions, ext)
+		ws, res := dialWebSocket(t, srv, header)
+		if ws == nil {
+			t.Fatal("handshake:", res.Status)
+		}
+		if ws.Subprotocol() != "v2" || ws.compress != (ext != "") {
+			t.Fatal("negotiation:", res.Header)
+		}
+		testWebSocketEcho(t, ws, closed)
+	}
+
+	// the client frames must be masked.
+	ws, _ := dialWebSocket(t, srv, http.Header{})
+	ws.server = true
+	_ = ws.WriteText("unmasked")
+	ws.server = false
+	var ce *CloseError
+	if err := <-closed; !errors.As(err, &ce) || ce.Code != CloseProtocolError {
+		t.Fatal("unmasked:", err)
+	}
+	if _, _, err := ws.ReadMessage(); !errors.As(err, &ce) || ce.Code != CloseProtocolError {
+		t.Fatal("protocol error close:", err)
+	}
+
+	// too big and invalid UTF-8.
+	for code, msg := range map[int]string{CloseTooBig: strings.Repeat("a", 1<<16+1), CloseInvalidPayload: "\xff"} {
+		ws, _ = dialWebSocket(t, srv, http.Header{})
+		_ = ws.WriteText(msg)
+		if err := <-closed; !errors.As(err, &ce) || ce.Code != code {
+			t.Fatal(code, err)
+		}
+	}
+
+	res, err := srv.Client().Get(srv.URL + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatal("not an upgrade:", res.Status)
+	}
+	header := http.Header{}
+	header.Set("Origin", "http://evil.example.com")
+	if ws, res := dialWebSocket(t, srv, header); ws != nil || res.StatusCode != http.StatusForbidden {
+		t.Fatal("origin:", res.Status)
+	}
+	// a writer that can't be hijacked fails the upgrade.
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set(HeaderConnection, "Upgrade")
+	req.Header.Set(HeaderUpgrade, "websocket")
+	req.Header.Set(HeaderSecWebSocketKey, "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set(HeaderSecWebSocketVersion, "13")
+	rec := httptest.NewRecorder()
+	echoWebSocket(t, closed).ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatal("hijack:", rec.Code, rec.Body)
+	}
+}
+
+// TestWebSocketHTTP2 runs in a process with the extended CONNECT of
+// HTTP/2 enabled.
+func TestWebSocketHTTP2(t *testing.T) {
+
+	if !strings.Contains(os.Getenv("GODEBUG"), "http2xconnect=1") {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestWebSocketHTTP2$")
+		cmd.Env = append(os.Environ(), "GODEBUG=http2xconnect=1")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatal(err, string(out))
+		}
+		return
+	}
+
+	closed := make(chan error, 1)
+	srv := httptest.NewUnstartedServer(echoWebSocket(t, closed))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	tr := &http2.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	cx, cancel := ctx.WithCancel(ctx.Background())
+	defer cancel()
+	pr, pw := io.Pipe()
+	req, _ := http.NewRequestWithContext(cx, http.MethodConnect, srv.URL+"/ws", pr)
+	req.Header.Set(":protocol", "websocket")
+	req.Header.Set(HeaderSecWebSocketVersion, "13")
+	req.Header.Set(HeaderSecWebSocketExtensions, "permessage-deflate")
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || res.ProtoMajor != 2 {
+		t.Fatal("handshake:", res.Proto, res.Status)
+	}
+	ws := clientWebSocket(bufio.NewReader(res.Body), pw, func() error { return nil }, pw.Close, res)
+	if !ws.compress {
+		t.Fatal("negotiation:", res.Header)
+	}
+	testWebSocketEcho(t, ws, closed)
+}